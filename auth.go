@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const (
+	accessTokenIssuer   = "chirpy-access"
+	refreshTokenIssuer  = "chirpy-refresh"
+	tokenAudience       = "chirpy"
+	accessTokenLifetime = time.Hour
+
+	scopeAdmin = "admin"
+)
+
+const principalContextKey contextKey = "principal"
+
+var errMissingToken = errors.New("missing bearer token")
+
+// Principal is the user an access token was issued to, as placed in the
+// request context by RequireAuth and OptionalAuth.
+type Principal struct {
+	UserID int
+	Scopes []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenClaims struct {
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+const (
+	authSchemeBearer = "Bearer"
+	authSchemeAPIKey = "ApiKey"
+)
+
+// authorizationCredentials returns the credentials in the Authorization
+// header if it uses scheme, and "" otherwise. Schemes are compared
+// case-insensitively, as HTTP requires.
+func authorizationCredentials(r *http.Request, scheme string) string {
+	authScheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(authScheme, scheme) {
+		return ""
+	}
+	return credentials
+}
+
+// parseToken verifies the signature, issuer and expiry of a token. Tokens
+// without an exp are refused.
+func (cfg *apiConfig) parseToken(tokenString string, issuer string, opts ...jwt.ParserOption) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	opts = append(opts, jwt.WithIssuer(issuer), jwt.WithIssuedAt())
+
+	if _, err := jwt.ParseWithClaims(tokenString, claims, cfg.keys.keyFunc, opts...); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+
+	return claims, nil
+}
+
+func (cfg *apiConfig) authenticate(r *http.Request) (Principal, error) {
+	tokenString := authorizationCredentials(r, authSchemeBearer)
+	if tokenString == "" {
+		return Principal{}, errMissingToken
+	}
+
+	claims, err := cfg.parseToken(tokenString, accessTokenIssuer, jwt.WithAudience(tokenAudience))
+	if err != nil {
+		return Principal{}, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return Principal{}, errors.New("token subject is not a user ID")
+	}
+
+	return Principal{UserID: userID, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+// RequireAuth rejects requests without a valid access token. Suspended
+// users keep read-only access but can't change anything; db is where their
+// suspension is looked up.
+func (cfg *apiConfig) RequireAuth(db database.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := cfg.authenticate(r)
+			if errors.Is(err, errMissingToken) {
+				respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+				return
+			}
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+				return
+			}
+
+			if !isReadOnly(r) && isSuspended(db, principal.UserID) {
+				respondWithError(w, http.StatusForbidden, "Account suspended")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), principalContextKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func isReadOnly(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// principalFrom returns the principal placed in ctx by RequireAuth or
+// OptionalAuth. Handlers that need a user must fail closed when it is
+// missing rather than act as user 0.
+func principalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(Principal)
+	return principal, ok
+}
+
+// OptionalAuth adds the principal when the request carries a valid access
+// token and otherwise serves the request anonymously.
+func (cfg *apiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (cfg *apiConfig) scopesFor(userID int) string {
+	if cfg.isAdmin(userID) {
+		return scopeAdmin
+	}
+	return ""
+}
+
+func (cfg *apiConfig) signAccessToken(userID int) (string, error) {
+	now := time.Now().UTC()
+
+	return cfg.keys.sign(tokenClaims{
+		Scope: cfg.scopesFor(userID),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    accessTokenIssuer,
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenLifetime)),
+		},
+	})
+}
@@ -2,42 +2,200 @@ package database
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"strconv"
+	"time"
+
+	"github.com/rivo/uniseg"
+)
+
+const (
+	ChirpLengthLimit     = 140
+	ChirpyRedLengthLimit = 280
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	AuthorID  int        `json:"author_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	HiddenAt  *time.Time `json:"hidden_at,omitempty"`
+	InReplyTo *int       `json:"in_reply_to,omitempty"`
+
+	RechirpOfID   *int `json:"rechirp_of_id,omitempty"`
+	QuotedChirpID *int `json:"quoted_chirp_id,omitempty"`
+
+	Hashtags []string `json:"hashtags,omitempty"`
+	Mentions []int    `json:"mentions,omitempty"`
+	MediaIDs []string `json:"media_ids,omitempty"`
+
+	RechirpOf   *ChirpRef `json:"rechirp_of,omitempty"`
+	QuotedChirp *ChirpRef `json:"quoted_chirp,omitempty"`
+
+	ReplyCount   int   `json:"reply_count"`
+	LikeCount    int   `json:"like_count"`
+	RechirpCount int   `json:"rechirp_count"`
+	LikedByMe    *bool `json:"liked_by_me,omitempty"`
 }
 
-func (db *DB) CreateChirp(body string, ID string) (Chirp, error) {
-	db.mux.Lock()
-	defer db.mux.Unlock()
+// ChirpRef is a rechirped or quoted chirp expanded inline. If the original
+// has been deleted, or is hidden from the viewer, only its ID is kept,
+// marked as a tombstone.
+type ChirpRef struct {
+	ID      int  `json:"id"`
+	Deleted bool `json:"deleted,omitempty"`
+	Hidden  bool `json:"hidden,omitempty"`
+	*Chirp
+}
+
+type ChirpOptions struct {
+	InReplyTo     *int
+	QuotedChirpID *int
+	Hashtags      []string
+	Mentions      []int
+	MediaIDs      []string
+}
+
+type ChirpRevision struct {
+	ID        int       `json:"id"`
+	ChirpID   int       `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChirpTooLongError is returned when a chirp body is over its author's
+// length limit.
+type ChirpTooLongError struct {
+	Length int
+	Limit  int
+}
 
-	if len(body) > 140 {
-		return Chirp{}, errors.New("Chirp is too long")
+func (e *ChirpTooLongError) Error() string {
+	return fmt.Sprintf("chirp is %d characters long, the limit is %d", e.Length, e.Limit)
+}
+
+// ChirpLength counts user-perceived characters, so an emoji or a letter
+// with combining accents counts once however many bytes or runes it takes.
+func ChirpLength(body string) int {
+	return uniseg.GraphemeClusterCount(body)
+}
+
+func chirpLengthLimit(isChirpyRed bool) int {
+	if isChirpyRed {
+		return ChirpyRedLengthLimit
+	}
+	return ChirpLengthLimit
+}
+
+func validateChirpBody(body string, isChirpyRed bool) error {
+	length := ChirpLength(body)
+	limit := chirpLengthLimit(isChirpyRed)
+	if length > limit {
+		return &ChirpTooLongError{Length: length, Limit: limit}
 	}
 
+	return nil
+}
+
+func (db *DB) CreateChirp(body string, ID string, opts ChirpOptions) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
 	authorID, err := strconv.Atoi(ID)
 	if err != nil {
 		panic(err)
 	}
 
+	if err := validateChirpBody(body, db.users[authorID].IsChirpyRed); err != nil {
+		return Chirp{}, err
+	}
+
+	for _, ref := range []*int{opts.InReplyTo, opts.QuotedChirpID} {
+		if ref == nil {
+			continue
+		}
+		if _, ok := db.chirps[*ref]; !ok {
+			return Chirp{}, ErrReferencedChirpNotFound
+		}
+	}
+
+	for _, mediaID := range opts.MediaIDs {
+		if _, ok := db.media[mediaID]; !ok {
+			return Chirp{}, ErrReferencedMediaNotFound
+		}
+	}
+
+	now := time.Now().UTC()
+
+	chirp := Chirp{
+		ID:        db.nextIDs.Chirp,
+		Body:      body,
+		AuthorID:  authorID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		InReplyTo: opts.InReplyTo,
+
+		QuotedChirpID: opts.QuotedChirpID,
+		Hashtags:      opts.Hashtags,
+		Mentions:      opts.Mentions,
+		MediaIDs:      opts.MediaIDs,
+	}
+
+	db.chirps[chirp.ID] = chirp
+	db.indexChirp(chirp)
+	db.nextIDs.Chirp++
+
+	if err := db.appendJournal(journalEntry{Op: opPutChirp, Chirp: &chirp}); err != nil {
+		return Chirp{}, err
+	}
+
+	return db.hydrateChirp(chirp), nil
+}
+
+func (db *DB) Rechirp(chirpID int, userID int) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	original, ok := db.chirps[chirpID]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+	if original.RechirpOfID != nil {
+		original, ok = db.chirps[*original.RechirpOfID]
+		if !ok {
+			return Chirp{}, ErrNotFound
+		}
+	}
+
+	for _, chirp := range db.chirps {
+		if chirp.AuthorID == userID && chirp.RechirpOfID != nil && *chirp.RechirpOfID == original.ID {
+			return Chirp{}, ErrDuplicate
+		}
+	}
+
+	now := time.Now().UTC()
+	originalID := original.ID
+
 	chirp := Chirp{
-		ID:       db.nextID,
-		Body:     body,
-		AuthorID: authorID,
+		ID:          db.nextIDs.Chirp,
+		AuthorID:    userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		RechirpOfID: &originalID,
 	}
 
 	db.chirps[chirp.ID] = chirp
-	db.nextID++
+	db.indexChirp(chirp)
+	db.nextIDs.Chirp++
 
-	if err := db.writeDB(); err != nil {
+	if err := db.appendJournal(journalEntry{Op: opPutChirp, Chirp: &chirp}); err != nil {
 		return Chirp{}, err
 	}
 
-	return chirp, nil
+	return db.hydrateChirp(chirp), nil
 }
 
 func (db *DB) GetChirps() ([]Chirp, error) {
@@ -49,14 +207,217 @@ func (db *DB) GetChirps() ([]Chirp, error) {
 		chirps = append(chirps, chirp)
 	}
 
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].ID < chirps[j].ID
+	})
+	db.hydrateChirps(chirps)
+
 	return chirps, nil
 }
 
-func (db *DB) DeleteChirp(chirp Chirp) error {
+func (db *DB) GetChirp(id int) (Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	chirp, ok := db.chirps[id]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+
+	return db.hydrateChirp(chirp), nil
+}
+
+func (db *DB) DeleteChirp(id int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.chirps[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	db.removeChirp(id)
+
+	return db.appendJournal(journalEntry{Op: opDeleteChirp, Chirp: &chirp})
+}
+
+func (db *DB) removeChirp(id int) {
+	db.unindexChirp(db.chirps[id])
+	delete(db.chirps, id)
+	delete(db.replyCounts, id)
+	delete(db.likeCounts, id)
+
+	for replyID, reply := range db.chirps {
+		if reply.InReplyTo != nil && *reply.InReplyTo == id {
+			reply.InReplyTo = nil
+			db.chirps[replyID] = reply
+		}
+	}
+
+	for revisionID, revision := range db.chirpRevisions {
+		if revision.ChirpID == id {
+			delete(db.chirpRevisions, revisionID)
+		}
+	}
+
+	for likeID, like := range db.likes {
+		if like.ChirpID == id {
+			delete(db.likes, likeID)
+		}
+	}
+
+	for notificationID, notification := range db.notifications {
+		if notification.ChirpID != nil && *notification.ChirpID == id {
+			delete(db.notifications, notificationID)
+		}
+	}
+
+	for reportID, report := range db.reports {
+		if report.ChirpID == id {
+			delete(db.reports, reportID)
+		}
+	}
+}
+
+func (db *DB) UpdateChirp(id int, body string, hashtags []string, mentions []int) (Chirp, error) {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
-	delete(db.chirps, chirp.ID)
+	chirp, ok := db.chirps[id]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+
+	if err := validateChirpBody(body, db.users[chirp.AuthorID].IsChirpyRed); err != nil {
+		return Chirp{}, err
+	}
+
+	revision := ChirpRevision{
+		ID:        db.nextIDs.ChirpRevision,
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: chirp.UpdatedAt,
+	}
+
+	db.unindexChirp(chirp)
+
+	now := time.Now().UTC()
+	chirp.Body = body
+	chirp.Hashtags = hashtags
+	chirp.Mentions = mentions
+	chirp.UpdatedAt = now
+	chirp.EditedAt = &now
+
+	db.chirpRevisions[revision.ID] = revision
+	db.nextIDs.ChirpRevision++
+	db.chirps[chirp.ID] = chirp
+	db.indexChirp(chirp)
+
+	if err := db.appendJournal(journalEntry{Op: opEditChirp, Chirp: &chirp, ChirpRevision: &revision}); err != nil {
+		return Chirp{}, err
+	}
+
+	return db.hydrateChirp(chirp), nil
+}
+
+func (db *DB) GetChirpRevisions(chirpID int) ([]ChirpRevision, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	if _, ok := db.chirps[chirpID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	revisions := []ChirpRevision{}
+	for _, revision := range db.chirpRevisions {
+		if revision.ChirpID == chirpID {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].ID < revisions[j].ID
+	})
+
+	return revisions, nil
+}
+
+func (db *DB) GetReplies(chirpID int) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	if _, ok := db.chirps[chirpID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	replies := []Chirp{}
+	for _, chirp := range db.chirps {
+		if chirp.InReplyTo != nil && *chirp.InReplyTo == chirpID {
+			replies = append(replies, chirp)
+		}
+	}
+
+	sort.Slice(replies, func(i, j int) bool {
+		return replies[i].ID < replies[j].ID
+	})
+	db.hydrateChirps(replies)
+
+	return replies, nil
+}
+
+func (db *DB) hydrateChirp(chirp Chirp) Chirp {
+	chirps := []Chirp{chirp}
+	db.hydrateChirps(chirps)
+	return chirps[0]
+}
+
+func (db *DB) hydrateChirps(chirps []Chirp) {
+	addCounts := func(chirp *Chirp) {
+		chirp.ReplyCount = db.replyCounts[chirp.ID]
+		chirp.LikeCount = db.likeCounts[chirp.ID]
+		chirp.RechirpCount = db.rechirpCounts[chirp.ID]
+	}
+
+	for i := range chirps {
+		addCounts(&chirps[i])
+	}
+
+	expandChirpRefs(chirps, func(id int) (Chirp, error) {
+		chirp, ok := db.chirps[id]
+		if !ok {
+			return Chirp{}, ErrNotFound
+		}
+		addCounts(&chirp)
+		return chirp, nil
+	})
+}
+
+func expandChirpRefs(chirps []Chirp, lookup func(id int) (Chirp, error)) error {
+	expand := func(id *int) (*ChirpRef, error) {
+		if id == nil {
+			return nil, nil
+		}
+
+		chirp, err := lookup(*id)
+		if errors.Is(err, ErrNotFound) {
+			return &ChirpRef{ID: *id, Deleted: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &ChirpRef{ID: chirp.ID, Chirp: &chirp}, nil
+	}
+
+	for i := range chirps {
+		var err error
+		if chirps[i].RechirpOf, err = expand(chirps[i].RechirpOfID); err != nil {
+			return err
+		}
+		if chirps[i].QuotedChirp, err = expand(chirps[i].QuotedChirpID); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -2,41 +2,107 @@ package database
 
 import (
 	"encoding/json"
-	"errors"
 	"os"
-	"strconv"
+	"path/filepath"
 	"sync"
 )
 
 type DB struct {
-	path               string
-	mux                *sync.RWMutex
-	chirps             map[int]Chirp
-	users              map[int]User
-	revokedTokens      map[int]RevokedToken
-	nextID             int
-	nextUserID         int
-	nextRevokedTokenID int
-	dbLoaded           bool
+	path              string
+	mux               *sync.RWMutex
+	chirps            map[int]Chirp
+	users             map[int]User
+	revokedTokens     map[int]RevokedToken
+	revokedTokenIndex map[string]int
+	chirpRevisions    map[int]ChirpRevision
+	likes             map[int]Like
+	follows           map[int]Follow
+	notifications     map[int]Notification
+	reports           map[int]Report
+	moderationActions map[int]ModerationAction
+	media             map[string]Media
+	refreshTokens     map[string]RefreshToken
+	hashtagIndex      map[string]map[int]bool
+	searchIndex       map[string]map[int]int
+	authorIndex       map[int]map[int]bool
+	replyCounts       map[int]int
+	rechirpCounts     map[int]int
+	likeCounts        map[int]int
+	nextIDs           NextIDs
+	dbLoaded          bool
+	journal           *os.File
+	journalEntries    int
 }
 
 type DBStructure struct {
-	Chirps        map[int]Chirp        `json:"chirps"`
-	Users         map[int]User         `json:"users"`
-	RevokedTokens map[int]RevokedToken `json:"revoked_tokens"`
+	SchemaVersion     int                      `json:"schema_version"`
+	Chirps            map[int]Chirp            `json:"chirps"`
+	Users             map[int]User             `json:"users"`
+	RevokedTokens     map[int]RevokedToken     `json:"revoked_tokens"`
+	ChirpRevisions    map[int]ChirpRevision    `json:"chirp_revisions"`
+	Likes             map[int]Like             `json:"likes"`
+	Follows           map[int]Follow           `json:"follows"`
+	Notifications     map[int]Notification     `json:"notifications"`
+	Reports           map[int]Report           `json:"reports"`
+	ModerationActions map[int]ModerationAction `json:"moderation_actions"`
+	Media             map[string]Media         `json:"media"`
+	RefreshTokens     map[string]RefreshToken  `json:"refresh_tokens"`
+	NextIDs           NextIDs                  `json:"next_ids"`
+}
+
+// NextIDs holds the ID each record type will be given next. It is persisted
+// rather than derived from the highest ID on load, so the IDs of deleted
+// records are never handed out again.
+type NextIDs struct {
+	Chirp            int `json:"chirp"`
+	User             int `json:"user"`
+	RevokedToken     int `json:"revoked_token"`
+	ChirpRevision    int `json:"chirp_revision"`
+	Like             int `json:"like"`
+	Follow           int `json:"follow"`
+	Notification     int `json:"notification"`
+	Report           int `json:"report"`
+	ModerationAction int `json:"moderation_action"`
+}
+
+func newNextIDs() NextIDs {
+	return NextIDs{
+		Chirp:            1,
+		User:             1,
+		RevokedToken:     1,
+		ChirpRevision:    1,
+		Like:             1,
+		Follow:           1,
+		Notification:     1,
+		Report:           1,
+		ModerationAction: 1,
+	}
 }
 
 func NewDB(path string) (*DB, error) {
 	db := &DB{
-		path:               path,
-		mux:                &sync.RWMutex{},
-		chirps:             make(map[int]Chirp),
-		users:              make(map[int]User),
-		revokedTokens:      make(map[int]RevokedToken),
-		nextID:             1,
-		nextUserID:         1,
-		nextRevokedTokenID: 1,
-		dbLoaded:           false,
+		path:              path,
+		mux:               &sync.RWMutex{},
+		chirps:            make(map[int]Chirp),
+		users:             make(map[int]User),
+		revokedTokens:     make(map[int]RevokedToken),
+		revokedTokenIndex: make(map[string]int),
+		chirpRevisions:    make(map[int]ChirpRevision),
+		likes:             make(map[int]Like),
+		follows:           make(map[int]Follow),
+		notifications:     make(map[int]Notification),
+		reports:           make(map[int]Report),
+		moderationActions: make(map[int]ModerationAction),
+		media:             make(map[string]Media),
+		refreshTokens:     make(map[string]RefreshToken),
+		hashtagIndex:      make(map[string]map[int]bool),
+		searchIndex:       make(map[string]map[int]int),
+		authorIndex:       make(map[int]map[int]bool),
+		replyCounts:       make(map[int]int),
+		rechirpCounts:     make(map[int]int),
+		likeCounts:        make(map[int]int),
+		nextIDs:           newNextIDs(),
+		dbLoaded:          false,
 	}
 
 	if err := db.loadDB(); err != nil {
@@ -47,16 +113,66 @@ func NewDB(path string) (*DB, error) {
 }
 
 func (db *DB) writeDB() error {
-	data, err := json.Marshal(map[string]interface{}{
-		"chirps":         db.chirps,
-		"users":          db.users,
-		"revoked_tokens": db.revokedTokens,
+	data, err := json.Marshal(DBStructure{
+		SchemaVersion:     currentSchemaVersion,
+		Chirps:            db.chirps,
+		Users:             db.users,
+		RevokedTokens:     db.revokedTokens,
+		ChirpRevisions:    db.chirpRevisions,
+		Likes:             db.likes,
+		Follows:           db.follows,
+		Notifications:     db.notifications,
+		Media:             db.media,
+		Reports:           db.reports,
+		ModerationActions: db.moderationActions,
+		RefreshTokens:     db.refreshTokens,
+		NextIDs:           db.nextIDs,
 	})
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(db.path, data, 0644)
+	return writeFileAtomic(db.path, data, 0644)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
 }
 
 func (db *DB) loadDB() error {
@@ -72,92 +188,36 @@ func (db *DB) loadDB() error {
 		return err
 	}
 
-	var dbStructure map[string]interface{}
-	if err := json.Unmarshal(data, &dbStructure); err != nil && len(data) != 0 {
+	var dbStructure DBStructure
+	if len(data) == 0 {
+		dbStructure.SchemaVersion = currentSchemaVersion
+		dbStructure.NextIDs = newNextIDs()
+	} else if err := json.Unmarshal(data, &dbStructure); err != nil {
 		return err
 	}
 
-	if dbStructure == nil {
-		dbStructure = make(map[string]interface{})
+	if err := upgradeDBStructure(&dbStructure); err != nil {
+		return err
 	}
 
-	if chirpsData, ok := dbStructure["chirps"].(map[string]interface{}); ok {
-		db.chirps = make(map[int]Chirp)
-		for key, val := range chirpsData {
-			id, _ := strconv.Atoi(key)
-
-			chirpMap, ok := val.(map[string]interface{})
-			if !ok {
-				return errors.New("chirp data is invalid")
-			}
-
-			body, ok := chirpMap["body"].(string)
-			if !ok {
-				return errors.New("chirp body is missing or not a string")
-			}
-
-			chirp := Chirp{
-				ID:   id,
-				Body: body,
-			}
-			db.chirps[id] = chirp
-		}
-		db.nextID = findMaxID(db.chirps) + 1
-	}
-
-	if usersData, ok := dbStructure["users"].(map[string]interface{}); ok {
-		db.users = make(map[int]User)
-		for key, val := range usersData {
-			id, _ := strconv.Atoi(key)
-
-			userMap, ok := val.(map[string]interface{})
-			if !ok {
-				return errors.New("user data is invalid")
-			}
-
-			email, ok := userMap["email"].(string)
-			if !ok {
-				return errors.New("user email is missing or not a string")
-			}
-
-			password, ok := userMap["password"].(string)
-			if !ok {
-				return errors.New("user password is missing or not a string")
-			}
-
-			user := User{
-				ID:       id,
-				Email:    email,
-				Password: password,
-			}
-			db.users[id] = user
-		}
-		db.nextUserID = findMaxID(db.users) + 1
+	db.chirps = dbStructure.Chirps
+	db.users = dbStructure.Users
+	db.revokedTokens = dbStructure.RevokedTokens
+	db.chirpRevisions = dbStructure.ChirpRevisions
+	db.likes = dbStructure.Likes
+	db.follows = dbStructure.Follows
+	db.notifications = dbStructure.Notifications
+	db.media = dbStructure.Media
+	db.reports = dbStructure.Reports
+	db.moderationActions = dbStructure.ModerationActions
+	db.refreshTokens = dbStructure.RefreshTokens
+	db.nextIDs = dbStructure.NextIDs
+
+	if err := db.replayJournal(); err != nil {
+		return err
 	}
 
-	if revokedTokensData, ok := dbStructure["revoked_tokens"].(map[string]interface{}); ok {
-		db.revokedTokens = make(map[int]RevokedToken)
-		for key, val := range revokedTokensData {
-			id, _ := strconv.Atoi(key)
-
-			revokedTokenMap, ok := val.(map[string]interface{})
-			if !ok {
-				return errors.New("user data is invalid")
-			}
-
-			revokedTokenID, ok := revokedTokenMap["revoked_token_id"].(string)
-			if !ok {
-				return errors.New("revoked token id is missing")
-			}
-
-			revokedToken := RevokedToken{
-				ID:             id,
-				RevokedTokenID: revokedTokenID,
-			}
-			db.revokedTokens[id] = revokedToken
-		}
-		db.nextRevokedTokenID = findMaxID(db.revokedTokens) + 1
-	}
+	db.rebuildIndexes()
 
 	db.dbLoaded = true
 
@@ -171,41 +231,49 @@ func (db *DB) DeleteDB(path string) error {
 	db.chirps = make(map[int]Chirp)
 	db.users = make(map[int]User)
 	db.revokedTokens = make(map[int]RevokedToken)
-	db.nextID = 1
-	db.nextUserID = 1
-	db.nextRevokedTokenID = 1
+	db.revokedTokenIndex = make(map[string]int)
+	db.chirpRevisions = make(map[int]ChirpRevision)
+	db.likes = make(map[int]Like)
+	db.follows = make(map[int]Follow)
+	db.notifications = make(map[int]Notification)
+	db.reports = make(map[int]Report)
+	db.moderationActions = make(map[int]ModerationAction)
+	db.media = make(map[string]Media)
+	db.refreshTokens = make(map[string]RefreshToken)
+	db.hashtagIndex = make(map[string]map[int]bool)
+	db.searchIndex = make(map[string]map[int]int)
+	db.authorIndex = make(map[int]map[int]bool)
+	db.replyCounts = make(map[int]int)
+	db.rechirpCounts = make(map[int]int)
+	db.likeCounts = make(map[int]int)
+	db.nextIDs = newNextIDs()
 	db.dbLoaded = false
+	db.journalEntries = 0
 
-	err := os.Remove(path)
+	if db.journal != nil {
+		db.journal.Close()
+		db.journal = nil
+	}
 
-	if err != nil {
+	if err := os.Remove(db.journalPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Writes may only have reached the journal so far, so a missing
+	// snapshot still leaves data to delete.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
 	return nil
 }
 
-func findMaxID(jsonData interface{}) int {
+func findMaxID[T any](records map[int]T) int {
 	var maxID int
 
-	switch v := jsonData.(type) {
-	case map[int]Chirp:
-		for id := range v {
-			if id > maxID {
-				maxID = id
-			}
-		}
-	case map[int]User:
-		for id := range v {
-			if id > maxID {
-				maxID = id
-			}
-		}
-	case map[int]RevokedToken:
-		for id := range v {
-			if id > maxID {
-				maxID = id
-			}
+	for id := range records {
+		if id > maxID {
+			maxID = id
 		}
 	}
 
@@ -213,5 +281,8 @@ func findMaxID(jsonData interface{}) int {
 }
 
 func (db *DB) Close() error {
-	return db.writeDB()
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return db.compact()
 }
@@ -0,0 +1,433 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) (*DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	return db, path
+}
+
+func reopen(t *testing.T, path string) *DB {
+	t.Helper()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("reopening %s: %v", path, err)
+	}
+
+	return db
+}
+
+// structureOf is what writeDB would persist for db.
+func structureOf(db *DB) DBStructure {
+	return DBStructure{
+		SchemaVersion:     currentSchemaVersion,
+		Chirps:            db.chirps,
+		Users:             db.users,
+		RevokedTokens:     db.revokedTokens,
+		ChirpRevisions:    db.chirpRevisions,
+		Likes:             db.likes,
+		Follows:           db.follows,
+		Notifications:     db.notifications,
+		Reports:           db.reports,
+		ModerationActions: db.moderationActions,
+		Media:             db.media,
+		RefreshTokens:     db.refreshTokens,
+		NextIDs:           db.nextIDs,
+	}
+}
+
+func assertSameStructure(t *testing.T, got, want DBStructure) {
+	t.Helper()
+
+	gotValue := reflect.ValueOf(got)
+	wantValue := reflect.ValueOf(want)
+	for i := 0; i < gotValue.NumField(); i++ {
+		name := gotValue.Type().Field(i).Name
+		if !reflect.DeepEqual(gotValue.Field(i).Interface(), wantValue.Field(i).Interface()) {
+			t.Errorf("%s after reload:\n got %+v\nwant %+v", name, gotValue.Field(i).Interface(), wantValue.Field(i).Interface())
+		}
+	}
+}
+
+// fakeJWT builds an unsigned token carrying only an exp claim, which is all
+// tokenExpiry reads.
+func fakeJWT(exp time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	payload := fmt.Sprintf(`{"exp":%d}`, exp.Unix())
+	return encode([]byte(`{"alg":"HS256"}`)) + "." + encode([]byte(payload)) + ".sig"
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestWriteDBRoundTrip(t *testing.T) {
+	db, path := newTestDB(t)
+
+	now := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	later := now.Add(time.Hour)
+
+	db.users = map[int]User{
+		1: {ID: 1, Email: "a@example.com", Password: "hash", IsChirpyRed: true, Username: "alice", DisplayName: "Alice", Bio: "hi", Avatar: "https://example.com/a.png"},
+		2: {ID: 2, Email: "b@example.com", Password: "hash", SuspendedAt: &later},
+	}
+	db.chirps = map[int]Chirp{
+		1: {ID: 1, Body: "hello #go @bob", AuthorID: 1, CreatedAt: now, UpdatedAt: later, EditedAt: &later, Hashtags: []string{"go"}, Mentions: []int{2}, MediaIDs: []string{"m1"}},
+		2: {ID: 2, Body: "reply", AuthorID: 2, CreatedAt: now, UpdatedAt: now, InReplyTo: intPtr(1), QuotedChirpID: intPtr(1), HiddenAt: &later},
+		3: {ID: 3, AuthorID: 2, CreatedAt: now, UpdatedAt: now, RechirpOfID: intPtr(1)},
+	}
+	db.revokedTokens = map[int]RevokedToken{
+		1: {ID: 1, RevokedTokenID: "revoked", ExpiresAt: later},
+	}
+	db.chirpRevisions = map[int]ChirpRevision{
+		1: {ID: 1, ChirpID: 1, Body: "hello", CreatedAt: now},
+	}
+	db.likes = map[int]Like{
+		1: {ID: 1, ChirpID: 1, UserID: 2, CreatedAt: now},
+	}
+	db.follows = map[int]Follow{
+		1: {ID: 1, FollowerID: 2, FolloweeID: 1, CreatedAt: now},
+	}
+	db.notifications = map[int]Notification{
+		1: {ID: 1, UserID: 1, Type: "like", ActorID: 2, ChirpID: intPtr(1), CreatedAt: now, ReadAt: &later},
+	}
+	db.reports = map[int]Report{
+		1: {ID: 1, ChirpID: 2, ReporterID: intPtr(1), Reason: "spam", CreatedAt: now, ResolvedAt: &later},
+	}
+	db.moderationActions = map[int]ModerationAction{
+		1: {ID: 1, AdminID: 1, Action: "hide", ChirpID: intPtr(2), UserID: intPtr(2), Reason: "spam", CreatedAt: later},
+	}
+	db.media = map[string]Media{
+		"m1": {ID: "m1", OwnerID: 1, ContentType: "image/png", Size: 1024, Width: 64, Height: 32, CreatedAt: now},
+	}
+	db.refreshTokens = map[string]RefreshToken{
+		"r1": {ID: "r1", FamilyID: "f1", UserID: 1, IssuedAt: now, ExpiresAt: later, ReplacedBy: "r2", RevokedAt: &later},
+		"r2": {ID: "r2", FamilyID: "f1", UserID: 1, IssuedAt: later, ExpiresAt: later.Add(time.Hour)},
+	}
+
+	// Chirps 4 and 5 were deleted; their IDs must stay used.
+	db.nextIDs = NextIDs{Chirp: 6, User: 3, RevokedToken: 2, ChirpRevision: 2, Like: 2, Follow: 2, Notification: 2, Report: 2, ModerationAction: 2}
+
+	if err := db.writeDB(); err != nil {
+		t.Fatalf("writeDB: %v", err)
+	}
+
+	reloaded := reopen(t, path)
+	assertSameStructure(t, structureOf(reloaded), structureOf(db))
+	if _, ok := reloaded.revokedTokenIndex["revoked"]; !ok {
+		t.Error("revoked token index was not rebuilt on load")
+	}
+
+	chirp, err := reloaded.GetChirp(1)
+	if err != nil {
+		t.Fatalf("GetChirp: %v", err)
+	}
+	if chirp.ReplyCount != 1 || chirp.LikeCount != 1 || chirp.RechirpCount != 1 {
+		t.Errorf("counts after reload = replies %d, likes %d, rechirps %d; want 1 each",
+			chirp.ReplyCount, chirp.LikeCount, chirp.RechirpCount)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	db, path := newTestDB(t)
+
+	mustDo := func(what string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	}
+
+	_, err := db.CreateUser("a@example.com", "password", "alice")
+	mustDo("CreateUser", err)
+	_, err = db.CreateUser("b@example.com", "password", "bob")
+	mustDo("CreateUser", err)
+	_, err = db.UpdateUser(1, "a@example.com", "hash", true, true)
+	mustDo("UpdateUser", err)
+
+	_, err = db.CreateMedia(Media{ID: "m1", OwnerID: 1, ContentType: "image/png", Size: 10, Width: 1, Height: 1})
+	mustDo("CreateMedia", err)
+	_, err = db.CreateChirp("hello #go", "1", ChirpOptions{Hashtags: []string{"go"}, MediaIDs: []string{"m1"}})
+	mustDo("CreateChirp", err)
+	_, err = db.CreateChirp("reply", "2", ChirpOptions{InReplyTo: intPtr(1)})
+	mustDo("CreateChirp", err)
+	_, err = db.CreateChirp("doomed", "2", ChirpOptions{InReplyTo: intPtr(1)})
+	mustDo("CreateChirp", err)
+	mustDo("DeleteChirp", db.DeleteChirp(3))
+	_, err = db.UpdateChirp(1, "hello again #go @bob", []string{"go"}, []int{2})
+	mustDo("UpdateChirp", err)
+	_, err = db.Rechirp(1, 2)
+	mustDo("Rechirp", err)
+
+	mustDo("LikeChirp", db.LikeChirp(1, 2))
+	mustDo("LikeChirp", db.LikeChirp(2, 1))
+	mustDo("UnlikeChirp", db.UnlikeChirp(2, 1))
+	mustDo("Follow", db.Follow(2, 1))
+
+	_, err = db.CreateNotification(Notification{UserID: 1, Type: "like", ActorID: 2, ChirpID: intPtr(1)})
+	mustDo("CreateNotification", err)
+	_, err = db.CreateReport(Report{ChirpID: 2, ReporterID: intPtr(1), Reason: "spam"})
+	mustDo("CreateReport", err)
+	_, err = db.CreateModerationAction(ModerationAction{AdminID: 1, Action: "hide", ChirpID: intPtr(2)})
+	mustDo("CreateModerationAction", err)
+
+	now := time.Now().UTC()
+	mustDo("StoreRevokedToken", db.StoreRevokedToken("revoked", now.Add(time.Hour)))
+	mustDo("CreateRefreshToken", db.CreateRefreshToken(RefreshToken{ID: "r1", FamilyID: "f1", UserID: 1, IssuedAt: now, ExpiresAt: now.Add(-time.Minute)}))
+	mustDo("CreateRefreshToken", db.CreateRefreshToken(RefreshToken{ID: "r2", FamilyID: "f1", UserID: 1, IssuedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	purged, err := db.PurgeExpiredRefreshTokens(now)
+	mustDo("PurgeExpiredRefreshTokens", err)
+	if purged != 1 {
+		t.Fatalf("purged %d refresh tokens, want 1", purged)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("snapshot was written before the compaction threshold (stat err %v)", err)
+	}
+
+	reloaded := reopen(t, path)
+	assertSameStructure(t, structureOf(reloaded), structureOf(db))
+
+	if _, ok := reloaded.refreshTokens["r1"]; ok {
+		t.Error("purged refresh token came back on replay")
+	}
+
+	chirp, err := reloaded.GetChirp(1)
+	if err != nil {
+		t.Fatalf("GetChirp: %v", err)
+	}
+	if chirp.ReplyCount != 1 || chirp.LikeCount != 1 || chirp.RechirpCount != 1 {
+		t.Errorf("counts after replay = replies %d, likes %d, rechirps %d; want 1 each",
+			chirp.ReplyCount, chirp.LikeCount, chirp.RechirpCount)
+	}
+
+	// A torn final line is what a crash mid-append leaves behind.
+	journal, err := os.OpenFile(path+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("opening journal: %v", err)
+	}
+	if _, err := journal.WriteString(`{"op":"put_chirp","chirp":{"id":`); err != nil {
+		t.Fatalf("tearing journal: %v", err)
+	}
+	journal.Close()
+
+	torn := reopen(t, path)
+	assertSameStructure(t, structureOf(torn), structureOf(db))
+
+	// Appending after the tear must not glue the new entry onto the
+	// fragment, or it and everything after it is lost on the next replay.
+	_, err = torn.CreateChirp("after the tear", "1", ChirpOptions{})
+	mustDo("CreateChirp", err)
+
+	afterTear := reopen(t, path)
+	assertSameStructure(t, structureOf(afterTear), structureOf(torn))
+}
+
+func TestCorruptJournalEntryIsNotTruncated(t *testing.T) {
+	db, path := newTestDB(t)
+
+	if _, err := db.CreateUser("a@example.com", "password", "alice"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.CreateChirp("hello", "1", ChirpOptions{}); err != nil {
+			t.Fatalf("CreateChirp: %v", err)
+		}
+	}
+
+	journalPath := path + ".journal"
+	data, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("reading journal: %v", err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[2] = []byte("not json\n")
+	corrupt := bytes.Join(lines, nil)
+	if err := os.WriteFile(journalPath, corrupt, 0644); err != nil {
+		t.Fatalf("corrupting journal: %v", err)
+	}
+
+	if _, err := NewDB(path); err == nil {
+		t.Fatal("NewDB loaded a journal with a corrupt entry")
+	}
+
+	after, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("reading journal: %v", err)
+	}
+	if !bytes.Equal(after, corrupt) {
+		t.Error("loading a corrupt journal changed it")
+	}
+}
+
+func TestDeleteDBWithOnlyAJournal(t *testing.T) {
+	db, path := newTestDB(t)
+
+	if _, err := db.CreateUser("a@example.com", "password", "alice"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("snapshot exists before the compaction threshold (stat err %v)", err)
+	}
+
+	if err := db.DeleteDB(path); err != nil {
+		t.Fatalf("DeleteDB: %v", err)
+	}
+
+	if users := reopen(t, path).users; len(users) != 0 {
+		t.Errorf("%d users came back after DeleteDB", len(users))
+	}
+}
+
+func TestDeletedIDsAreNotReused(t *testing.T) {
+	db, path := newTestDB(t)
+
+	if _, err := db.CreateUser("a@example.com", "password", "alice"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	createAndDeleteNewest := func(db *DB, wantID int) {
+		t.Helper()
+
+		chirp, err := db.CreateChirp("spam", "1", ChirpOptions{})
+		if err != nil {
+			t.Fatalf("CreateChirp: %v", err)
+		}
+		if chirp.ID != wantID {
+			t.Fatalf("new chirp got ID %d, want %d", chirp.ID, wantID)
+		}
+		if err := db.DeleteChirp(chirp.ID); err != nil {
+			t.Fatalf("DeleteChirp: %v", err)
+		}
+	}
+
+	createAndDeleteNewest(db, 1)
+
+	// The delete is only in the journal here.
+	db = reopen(t, path)
+	createAndDeleteNewest(db, 2)
+
+	// And only in the snapshot here.
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	db = reopen(t, path)
+	createAndDeleteNewest(db, 3)
+}
+
+func TestSchemaUpgrades(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	token := fakeJWT(expiresAt)
+
+	// Version 1 files have no schema_version and records without IDs.
+	v1 := fmt.Sprintf(`{
+		"chirps": {"1": {"body": "hello", "author_id": 2}, "2": {"body": "again", "author_id": 2}},
+		"users": {"2": {"email": "a@example.com", "password": "hash", "is_chirpy_red": true}},
+		"revoked_tokens": {"1": {"revoked_token_id": %q}, "2": {"revoked_token_id": "not-a-jwt"}}
+	}`, token)
+
+	v2 := fmt.Sprintf(`{
+		"schema_version": 2,
+		"chirps": {"1": {"id": 1, "body": "hello", "author_id": 2}},
+		"users": {"2": {"id": 2, "email": "a@example.com", "password": "hash"}},
+		"revoked_tokens": {"1": {"id": 1, "revoked_token_id": %q}}
+	}`, token)
+
+	tests := []struct {
+		name  string
+		data  string
+		check func(t *testing.T, db *DB)
+	}{
+		{
+			name: "v1",
+			data: v1,
+			check: func(t *testing.T, db *DB) {
+				for id, chirp := range db.chirps {
+					if chirp.ID != id || chirp.AuthorID != 2 {
+						t.Errorf("chirp %d upgraded to %+v", id, chirp)
+					}
+				}
+				if user := db.users[2]; user.ID != 2 || !user.IsChirpyRed {
+					t.Errorf("user upgraded to %+v", user)
+				}
+				if got := db.revokedTokens[1]; got.ID != 1 || !got.ExpiresAt.Equal(expiresAt) {
+					t.Errorf("revoked token 1 upgraded to %+v, want expiry %v", got, expiresAt)
+				}
+				// Tokens that can't be parsed fall back to a legacy lifetime
+				// rather than being dropped or kept forever.
+				if got := db.revokedTokens[2]; got.ID != 2 || got.ExpiresAt.IsZero() {
+					t.Errorf("revoked token 2 upgraded to %+v", got)
+				}
+				if db.nextIDs.Chirp != 3 || db.nextIDs.User != 3 || db.nextIDs.RevokedToken != 3 {
+					t.Errorf("next IDs = %+v, want chirp 3, user 3, revoked token 3", db.nextIDs)
+				}
+			},
+		},
+		{
+			name: "v2",
+			data: v2,
+			check: func(t *testing.T, db *DB) {
+				if got := db.revokedTokens[1]; !got.ExpiresAt.Equal(expiresAt) {
+					t.Errorf("revoked token upgraded to %+v, want expiry %v", got, expiresAt)
+				}
+				if _, ok := db.revokedTokenIndex[token]; !ok {
+					t.Error("upgraded revoked token is missing from the index")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "database.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatalf("writing fixture: %v", err)
+			}
+
+			db := reopen(t, path)
+			tt.check(t, db)
+
+			// Every map is usable after an upgrade, even ones the old
+			// file didn't have.
+			if db.likes == nil || db.follows == nil || db.media == nil || db.refreshTokens == nil {
+				t.Error("upgrade left nil maps behind")
+			}
+
+			// Once written back, the file is at the current version and
+			// loads to the same state.
+			if err := db.writeDB(); err != nil {
+				t.Fatalf("writeDB: %v", err)
+			}
+			assertSameStructure(t, structureOf(reopen(t, path)), structureOf(db))
+		})
+	}
+}
+
+func TestNewerSchemaVersionIsRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	data := fmt.Sprintf(`{"schema_version": %d}`, currentSchemaVersion+1)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("writing fixture: %v", err)
+	}
+
+	if _, err := NewDB(path); err == nil {
+		t.Fatal("NewDB loaded a file from a newer schema version")
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+type Follow struct {
+	ID         int       `json:"id"`
+	FollowerID int       `json:"follower_id"`
+	FolloweeID int       `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (db *DB) Follow(followerID int, followeeID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.users[followeeID]; !ok {
+		return ErrNotFound
+	}
+
+	for _, follow := range db.follows {
+		if follow.FollowerID == followerID && follow.FolloweeID == followeeID {
+			return ErrDuplicate
+		}
+	}
+
+	follow := Follow{
+		ID:         db.nextIDs.Follow,
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	db.follows[follow.ID] = follow
+	db.nextIDs.Follow++
+
+	return db.appendJournal(journalEntry{Op: opPutFollow, Follow: &follow})
+}
+
+func (db *DB) Unfollow(followerID int, followeeID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	for _, follow := range db.follows {
+		if follow.FollowerID == followerID && follow.FolloweeID == followeeID {
+			delete(db.follows, follow.ID)
+			return db.appendJournal(journalEntry{Op: opDeleteFollow, Follow: &follow})
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (db *DB) GetFollowers(userID int) ([]Follow, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return db.filterFollows(userID, func(follow Follow) bool {
+		return follow.FolloweeID == userID
+	})
+}
+
+func (db *DB) GetFollowing(userID int) ([]Follow, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return db.filterFollows(userID, func(follow Follow) bool {
+		return follow.FollowerID == userID
+	})
+}
+
+func (db *DB) filterFollows(userID int, keep func(Follow) bool) ([]Follow, error) {
+	if _, ok := db.users[userID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	follows := []Follow{}
+	for _, follow := range db.follows {
+		if keep(follow) {
+			follows = append(follows, follow)
+		}
+	}
+
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].ID < follows[j].ID
+	})
+
+	return follows, nil
+}
+
+func (db *DB) GetChirpsByAuthors(authorIDs []int) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	seen := make(map[int]bool, len(authorIDs))
+	chirps := []Chirp{}
+	for _, authorID := range authorIDs {
+		if seen[authorID] {
+			continue
+		}
+		seen[authorID] = true
+
+		for chirpID := range db.authorIndex[authorID] {
+			chirps = append(chirps, db.chirps[chirpID])
+		}
+	}
+
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].ID < chirps[j].ID
+	})
+	db.hydrateChirps(chirps)
+
+	return chirps, nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+type HashtagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+func (db *DB) indexHashtags(chirp Chirp) {
+	for _, tag := range chirp.Hashtags {
+		if db.hashtagIndex[tag] == nil {
+			db.hashtagIndex[tag] = make(map[int]bool)
+		}
+		db.hashtagIndex[tag][chirp.ID] = true
+	}
+}
+
+func (db *DB) unindexHashtags(chirp Chirp) {
+	for _, tag := range chirp.Hashtags {
+		delete(db.hashtagIndex[tag], chirp.ID)
+		if len(db.hashtagIndex[tag]) == 0 {
+			delete(db.hashtagIndex, tag)
+		}
+	}
+}
+
+func (db *DB) GetChirpsByHashtag(tag string) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	chirps := []Chirp{}
+	for id := range db.hashtagIndex[tag] {
+		chirps = append(chirps, db.chirps[id])
+	}
+
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].ID < chirps[j].ID
+	})
+	db.hydrateChirps(chirps)
+
+	return chirps, nil
+}
+
+func (db *DB) GetTrendingHashtags(since time.Time, limit int) ([]HashtagCount, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	counts := make(map[string]int)
+	for _, chirp := range db.chirps {
+		if chirp.CreatedAt.Before(since) || chirp.HiddenAt != nil {
+			continue
+		}
+		for _, tag := range chirp.Hashtags {
+			counts[tag]++
+		}
+	}
+
+	trending := make([]HashtagCount, 0, len(counts))
+	for tag, count := range counts {
+		trending = append(trending, HashtagCount{Tag: tag, Count: count})
+	}
+
+	sortHashtagCounts(trending)
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+
+	return trending, nil
+}
+
+func sortHashtagCounts(counts []HashtagCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+}
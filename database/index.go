@@ -0,0 +1,63 @@
+package database
+
+func (db *DB) indexChirp(chirp Chirp) {
+	db.indexHashtags(chirp)
+	db.indexSearchTerms(chirp)
+
+	if db.authorIndex[chirp.AuthorID] == nil {
+		db.authorIndex[chirp.AuthorID] = make(map[int]bool)
+	}
+	db.authorIndex[chirp.AuthorID][chirp.ID] = true
+
+	if chirp.InReplyTo != nil {
+		db.replyCounts[*chirp.InReplyTo]++
+	}
+	if chirp.RechirpOfID != nil {
+		db.rechirpCounts[*chirp.RechirpOfID]++
+	}
+}
+
+func (db *DB) unindexChirp(chirp Chirp) {
+	db.unindexHashtags(chirp)
+	db.unindexSearchTerms(chirp)
+
+	delete(db.authorIndex[chirp.AuthorID], chirp.ID)
+	if len(db.authorIndex[chirp.AuthorID]) == 0 {
+		delete(db.authorIndex, chirp.AuthorID)
+	}
+
+	if chirp.InReplyTo != nil {
+		decrementCount(db.replyCounts, *chirp.InReplyTo)
+	}
+	if chirp.RechirpOfID != nil {
+		decrementCount(db.rechirpCounts, *chirp.RechirpOfID)
+	}
+}
+
+func decrementCount(counts map[int]int, id int) {
+	counts[id]--
+	if counts[id] <= 0 {
+		delete(counts, id)
+	}
+}
+
+func (db *DB) rebuildIndexes() {
+	db.hashtagIndex = make(map[string]map[int]bool)
+	db.searchIndex = make(map[string]map[int]int)
+	db.authorIndex = make(map[int]map[int]bool)
+	db.replyCounts = make(map[int]int)
+	db.rechirpCounts = make(map[int]int)
+	db.likeCounts = make(map[int]int)
+
+	for _, chirp := range db.chirps {
+		db.indexChirp(chirp)
+	}
+	for _, like := range db.likes {
+		db.likeCounts[like.ChirpID]++
+	}
+
+	db.revokedTokenIndex = make(map[string]int, len(db.revokedTokens))
+	for id, revokedToken := range db.revokedTokens {
+		db.revokedTokenIndex[revokedToken.RevokedTokenID] = id
+	}
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const journalCompactThreshold = 100
+
+const (
+	opPutChirp           = "put_chirp"
+	opDeleteChirp        = "delete_chirp"
+	opEditChirp          = "edit_chirp"
+	opPutUser            = "put_user"
+	opPutRevokedToken    = "put_revoked_token"
+	opDeleteRevokedToken = "delete_revoked_token"
+	opPutLike            = "put_like"
+	opDeleteLike         = "delete_like"
+	opPutFollow          = "put_follow"
+	opDeleteFollow       = "delete_follow"
+	opPutNotification    = "put_notification"
+	opPutMedia           = "put_media"
+	opPutReport          = "put_report"
+
+	opPutModerationAction = "put_moderation_action"
+	opPutRefreshToken     = "put_refresh_token"
+	opDeleteRefreshToken  = "delete_refresh_token"
+)
+
+type journalEntry struct {
+	Op            string         `json:"op"`
+	Chirp         *Chirp         `json:"chirp,omitempty"`
+	User          *User          `json:"user,omitempty"`
+	RevokedToken  *RevokedToken  `json:"revoked_token,omitempty"`
+	ChirpRevision *ChirpRevision `json:"chirp_revision,omitempty"`
+	Like          *Like          `json:"like,omitempty"`
+	Follow        *Follow        `json:"follow,omitempty"`
+	Notification  *Notification  `json:"notification,omitempty"`
+	Media         *Media         `json:"media,omitempty"`
+	Report        *Report        `json:"report,omitempty"`
+
+	ModerationAction *ModerationAction `json:"moderation_action,omitempty"`
+	RefreshToken     *RefreshToken     `json:"refresh_token,omitempty"`
+}
+
+func (db *DB) journalPath() string {
+	return db.path + ".journal"
+}
+
+func (db *DB) appendJournal(entry journalEntry) error {
+	if db.journal == nil {
+		f, err := os.OpenFile(db.journalPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		db.journal = f
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if _, err := db.journal.Write(data); err != nil {
+		return err
+	}
+	if err := db.journal.Sync(); err != nil {
+		return err
+	}
+
+	db.journalEntries++
+	if db.journalEntries >= journalCompactThreshold {
+		return db.compact()
+	}
+
+	return nil
+}
+
+func (db *DB) compact() error {
+	if err := db.writeDB(); err != nil {
+		return err
+	}
+
+	if db.journal != nil {
+		if err := db.journal.Close(); err != nil {
+			return err
+		}
+		db.journal = nil
+	}
+
+	if err := os.Remove(db.journalPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db.journalEntries = 0
+
+	return nil
+}
+
+func (db *DB) replayJournal() error {
+	data, err := os.ReadFile(db.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var offset int
+	for offset < len(data) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		line := data[offset:]
+		if end >= 0 {
+			line = data[offset : offset+end]
+		}
+
+		var entry journalEntry
+		if len(line) > 0 {
+			if end < 0 {
+				// A torn final line means we crashed mid-append; everything
+				// before it was synced. Cut it off so the next append starts
+				// on a fresh line instead of being glued onto the fragment.
+				return os.Truncate(db.journalPath(), int64(offset))
+			}
+			// A complete line that doesn't parse is corruption, not a
+			// crash, and the entries after it are still good, so leave
+			// the file for an operator to repair.
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return fmt.Errorf("corrupt journal entry at offset %d of %s: %w", offset, db.journalPath(), err)
+			}
+
+			if err := db.applyEntry(entry); err != nil {
+				return err
+			}
+			db.advanceNextIDs(entry)
+			db.journalEntries++
+		}
+
+		offset += end + 1
+	}
+
+	return nil
+}
+
+// advanceNextIDs moves the counters past any ID the entry mentions, deletes
+// included, so records created and deleted since the last snapshot don't
+// have their IDs reused.
+func (db *DB) advanceNextIDs(entry journalEntry) {
+	advance := func(next *int, id int) {
+		if id >= *next {
+			*next = id + 1
+		}
+	}
+
+	if entry.Chirp != nil {
+		advance(&db.nextIDs.Chirp, entry.Chirp.ID)
+	}
+	if entry.User != nil {
+		advance(&db.nextIDs.User, entry.User.ID)
+	}
+	if entry.RevokedToken != nil {
+		advance(&db.nextIDs.RevokedToken, entry.RevokedToken.ID)
+	}
+	if entry.ChirpRevision != nil {
+		advance(&db.nextIDs.ChirpRevision, entry.ChirpRevision.ID)
+	}
+	if entry.Like != nil {
+		advance(&db.nextIDs.Like, entry.Like.ID)
+	}
+	if entry.Follow != nil {
+		advance(&db.nextIDs.Follow, entry.Follow.ID)
+	}
+	if entry.Notification != nil {
+		advance(&db.nextIDs.Notification, entry.Notification.ID)
+	}
+	if entry.Report != nil {
+		advance(&db.nextIDs.Report, entry.Report.ID)
+	}
+	if entry.ModerationAction != nil {
+		advance(&db.nextIDs.ModerationAction, entry.ModerationAction.ID)
+	}
+}
+
+func (db *DB) applyEntry(entry journalEntry) error {
+	switch entry.Op {
+	case opPutChirp:
+		if entry.Chirp == nil {
+			return errors.New("journal entry is missing chirp")
+		}
+		db.chirps[entry.Chirp.ID] = *entry.Chirp
+	case opDeleteChirp:
+		if entry.Chirp == nil {
+			return errors.New("journal entry is missing chirp")
+		}
+		db.removeChirp(entry.Chirp.ID)
+	case opEditChirp:
+		if entry.Chirp == nil || entry.ChirpRevision == nil {
+			return errors.New("journal entry is missing chirp or revision")
+		}
+		db.chirps[entry.Chirp.ID] = *entry.Chirp
+		db.chirpRevisions[entry.ChirpRevision.ID] = *entry.ChirpRevision
+	case opPutUser:
+		if entry.User == nil {
+			return errors.New("journal entry is missing user")
+		}
+		db.users[entry.User.ID] = *entry.User
+	case opPutRevokedToken:
+		if entry.RevokedToken == nil {
+			return errors.New("journal entry is missing revoked token")
+		}
+		revokedToken := *entry.RevokedToken
+		if revokedToken.ExpiresAt.IsZero() {
+			revokedToken.ExpiresAt = tokenExpiry(revokedToken.RevokedTokenID, time.Now())
+		}
+		db.revokedTokens[revokedToken.ID] = revokedToken
+	case opDeleteRevokedToken:
+		if entry.RevokedToken == nil {
+			return errors.New("journal entry is missing revoked token")
+		}
+		delete(db.revokedTokens, entry.RevokedToken.ID)
+	case opPutLike:
+		if entry.Like == nil {
+			return errors.New("journal entry is missing like")
+		}
+		db.likes[entry.Like.ID] = *entry.Like
+	case opDeleteLike:
+		if entry.Like == nil {
+			return errors.New("journal entry is missing like")
+		}
+		delete(db.likes, entry.Like.ID)
+	case opPutFollow:
+		if entry.Follow == nil {
+			return errors.New("journal entry is missing follow")
+		}
+		db.follows[entry.Follow.ID] = *entry.Follow
+	case opDeleteFollow:
+		if entry.Follow == nil {
+			return errors.New("journal entry is missing follow")
+		}
+		delete(db.follows, entry.Follow.ID)
+	case opPutNotification:
+		if entry.Notification == nil {
+			return errors.New("journal entry is missing notification")
+		}
+		db.notifications[entry.Notification.ID] = *entry.Notification
+	case opPutMedia:
+		if entry.Media == nil {
+			return errors.New("journal entry is missing media")
+		}
+		db.media[entry.Media.ID] = *entry.Media
+	case opPutReport:
+		if entry.Report == nil {
+			return errors.New("journal entry is missing report")
+		}
+		db.reports[entry.Report.ID] = *entry.Report
+	case opPutModerationAction:
+		if entry.ModerationAction == nil {
+			return errors.New("journal entry is missing moderation action")
+		}
+		db.moderationActions[entry.ModerationAction.ID] = *entry.ModerationAction
+	case opPutRefreshToken:
+		if entry.RefreshToken == nil {
+			return errors.New("journal entry is missing refresh token")
+		}
+		db.refreshTokens[entry.RefreshToken.ID] = *entry.RefreshToken
+	case opDeleteRefreshToken:
+		if entry.RefreshToken == nil {
+			return errors.New("journal entry is missing refresh token")
+		}
+		delete(db.refreshTokens, entry.RefreshToken.ID)
+	default:
+		return fmt.Errorf("unknown journal operation: %s", entry.Op)
+	}
+
+	return nil
+}
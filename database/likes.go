@@ -0,0 +1,67 @@
+package database
+
+import "time"
+
+type Like struct {
+	ID        int       `json:"id"`
+	ChirpID   int       `json:"chirp_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) LikeChirp(chirpID int, userID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.chirps[chirpID]; !ok {
+		return ErrNotFound
+	}
+
+	for _, like := range db.likes {
+		if like.ChirpID == chirpID && like.UserID == userID {
+			return ErrDuplicate
+		}
+	}
+
+	like := Like{
+		ID:        db.nextIDs.Like,
+		ChirpID:   chirpID,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	db.likes[like.ID] = like
+	db.likeCounts[like.ChirpID]++
+	db.nextIDs.Like++
+
+	return db.appendJournal(journalEntry{Op: opPutLike, Like: &like})
+}
+
+func (db *DB) UnlikeChirp(chirpID int, userID int) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	for _, like := range db.likes {
+		if like.ChirpID == chirpID && like.UserID == userID {
+			delete(db.likes, like.ID)
+			decrementCount(db.likeCounts, like.ChirpID)
+			return db.appendJournal(journalEntry{Op: opDeleteLike, Like: &like})
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (db *DB) GetLikedChirpIDs(userID int) (map[int]bool, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	liked := make(map[int]bool)
+	for _, like := range db.likes {
+		if like.UserID == userID {
+			liked[like.ChirpID] = true
+		}
+	}
+
+	return liked, nil
+}
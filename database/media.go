@@ -0,0 +1,45 @@
+package database
+
+import "time"
+
+// Media is an uploaded image. Its ID is the SHA-256 of the file contents,
+// so uploading the same bytes twice yields the same record.
+type Media struct {
+	ID          string    `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateMedia(media Media) (Media, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if existing, ok := db.media[media.ID]; ok {
+		return existing, nil
+	}
+
+	media.CreatedAt = time.Now().UTC()
+	db.media[media.ID] = media
+
+	if err := db.appendJournal(journalEntry{Op: opPutMedia, Media: &media}); err != nil {
+		return Media{}, err
+	}
+
+	return media, nil
+}
+
+func (db *DB) GetMedia(id string) (Media, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	media, ok := db.media[id]
+	if !ok {
+		return Media{}, ErrNotFound
+	}
+
+	return media, nil
+}
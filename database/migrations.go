@@ -0,0 +1,278 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type migration struct {
+	version int
+	name    string
+	stmt    string
+}
+
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "create_chirps",
+		stmt: `CREATE TABLE chirps (
+			id        INTEGER PRIMARY KEY AUTOINCREMENT,
+			body      TEXT    NOT NULL,
+			author_id INTEGER NOT NULL
+		)`,
+	},
+	{
+		version: 2,
+		name:    "create_users",
+		stmt: `CREATE TABLE users (
+			id            INTEGER PRIMARY KEY AUTOINCREMENT,
+			email         TEXT    NOT NULL UNIQUE,
+			password      TEXT    NOT NULL,
+			is_chirpy_red INTEGER NOT NULL DEFAULT 0
+		)`,
+	},
+	{
+		version: 3,
+		name:    "create_revoked_tokens",
+		stmt: `CREATE TABLE revoked_tokens (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			revoked_token_id TEXT    NOT NULL
+		)`,
+	},
+	{
+		version: 4,
+		name:    "add_chirp_timestamps",
+		stmt: `ALTER TABLE chirps ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+			ALTER TABLE chirps ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+			CREATE INDEX chirps_created_at ON chirps (created_at)`,
+	},
+	{
+		version: 5,
+		name:    "create_chirp_revisions",
+		stmt: `ALTER TABLE chirps ADD COLUMN edited_at DATETIME;
+			CREATE TABLE chirp_revisions (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				chirp_id   INTEGER  NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				body       TEXT     NOT NULL,
+				created_at DATETIME NOT NULL
+			);
+			CREATE INDEX chirp_revisions_chirp_id ON chirp_revisions (chirp_id)`,
+	},
+	{
+		version: 6,
+		name:    "add_chirp_replies",
+		stmt: `ALTER TABLE chirps ADD COLUMN in_reply_to INTEGER REFERENCES chirps (id) ON DELETE SET NULL;
+			CREATE INDEX chirps_in_reply_to ON chirps (in_reply_to)`,
+	},
+	{
+		version: 7,
+		name:    "create_likes",
+		stmt: `CREATE TABLE likes (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				chirp_id   INTEGER  NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				user_id    INTEGER  NOT NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE (chirp_id, user_id)
+			);
+			CREATE INDEX likes_user_id ON likes (user_id)`,
+	},
+	{
+		version: 8,
+		name:    "add_rechirps_and_quotes",
+		stmt: `ALTER TABLE chirps ADD COLUMN rechirp_of INTEGER;
+			ALTER TABLE chirps ADD COLUMN quoted_chirp_id INTEGER;
+			CREATE UNIQUE INDEX chirps_rechirp_of_author ON chirps (rechirp_of, author_id) WHERE rechirp_of IS NOT NULL;
+			CREATE INDEX chirps_quoted_chirp_id ON chirps (quoted_chirp_id)`,
+	},
+	{
+		version: 9,
+		name:    "create_follows",
+		stmt: `CREATE TABLE follows (
+				id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+				follower_id INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				followee_id INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				created_at  DATETIME NOT NULL,
+				UNIQUE (follower_id, followee_id)
+			);
+			CREATE INDEX follows_followee_id ON follows (followee_id);
+			CREATE INDEX chirps_author_id ON chirps (author_id)`,
+	},
+	{
+		version: 10,
+		name:    "create_chirp_hashtags",
+		stmt: `CREATE TABLE chirp_hashtags (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				chirp_id   INTEGER  NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				tag        TEXT     NOT NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE (chirp_id, tag)
+			);
+			CREATE INDEX chirp_hashtags_tag ON chirp_hashtags (tag);
+			CREATE INDEX chirp_hashtags_created_at ON chirp_hashtags (created_at)`,
+	},
+	{
+		version: 11,
+		name:    "create_mentions_and_notifications",
+		stmt: `CREATE TABLE chirp_mentions (
+				id       INTEGER PRIMARY KEY AUTOINCREMENT,
+				chirp_id INTEGER NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				user_id  INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				UNIQUE (chirp_id, user_id)
+			);
+			CREATE INDEX chirp_mentions_user_id ON chirp_mentions (user_id);
+			CREATE TABLE notifications (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				type       TEXT     NOT NULL,
+				actor_id   INTEGER  NOT NULL,
+				chirp_id   INTEGER  REFERENCES chirps (id) ON DELETE CASCADE,
+				created_at DATETIME NOT NULL,
+				read_at    DATETIME
+			);
+			CREATE INDEX notifications_user_id ON notifications (user_id, id)`,
+	},
+	{
+		version: 12,
+		name:    "create_chirps_fts",
+		stmt: `CREATE VIRTUAL TABLE chirps_fts USING fts5(body, content='chirps', content_rowid='id', tokenize='unicode61');
+			CREATE TRIGGER chirps_fts_insert AFTER INSERT ON chirps BEGIN
+				INSERT INTO chirps_fts (rowid, body) VALUES (new.id, new.body);
+			END;
+			CREATE TRIGGER chirps_fts_delete AFTER DELETE ON chirps BEGIN
+				INSERT INTO chirps_fts (chirps_fts, rowid, body) VALUES ('delete', old.id, old.body);
+			END;
+			CREATE TRIGGER chirps_fts_update AFTER UPDATE OF body ON chirps BEGIN
+				INSERT INTO chirps_fts (chirps_fts, rowid, body) VALUES ('delete', old.id, old.body);
+				INSERT INTO chirps_fts (rowid, body) VALUES (new.id, new.body);
+			END;
+			INSERT INTO chirps_fts (chirps_fts) VALUES ('rebuild')`,
+	},
+	{
+		version: 13,
+		name:    "add_user_profiles",
+		stmt: `ALTER TABLE users ADD COLUMN username TEXT;
+			ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+			ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+			ALTER TABLE users ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
+			CREATE UNIQUE INDEX users_username ON users (username)`,
+	},
+	{
+		version: 14,
+		name:    "create_media",
+		stmt: `CREATE TABLE media (
+				id           TEXT     PRIMARY KEY,
+				owner_id     INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				content_type TEXT     NOT NULL,
+				size         INTEGER  NOT NULL,
+				width        INTEGER  NOT NULL,
+				height       INTEGER  NOT NULL,
+				created_at   DATETIME NOT NULL
+			);
+			CREATE TABLE chirp_media (
+				chirp_id INTEGER NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				media_id TEXT    NOT NULL REFERENCES media (id),
+				position INTEGER NOT NULL,
+				PRIMARY KEY (chirp_id, position)
+			)`,
+	},
+	{
+		version: 15,
+		name:    "create_reports",
+		stmt: `CREATE TABLE reports (
+				id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+				chirp_id    INTEGER  NOT NULL REFERENCES chirps (id) ON DELETE CASCADE,
+				reporter_id INTEGER  REFERENCES users (id) ON DELETE SET NULL,
+				reason      TEXT     NOT NULL,
+				created_at  DATETIME NOT NULL
+			);
+			CREATE INDEX reports_chirp_id ON reports (chirp_id)`,
+	},
+	{
+		version: 16,
+		name:    "add_moderation",
+		stmt: `ALTER TABLE chirps ADD COLUMN hidden_at DATETIME;
+			ALTER TABLE users ADD COLUMN suspended_at DATETIME;
+			ALTER TABLE reports ADD COLUMN resolved_at DATETIME;
+			CREATE TABLE moderation_actions (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				admin_id   INTEGER  NOT NULL,
+				action     TEXT     NOT NULL,
+				chirp_id   INTEGER,
+				user_id    INTEGER,
+				reason     TEXT     NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL
+			)`,
+	},
+	{
+		version: 17,
+		name:    "create_refresh_tokens",
+		stmt: `CREATE TABLE refresh_tokens (
+				id          TEXT     PRIMARY KEY,
+				family_id   TEXT     NOT NULL,
+				user_id     INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+				issued_at   DATETIME NOT NULL,
+				expires_at  DATETIME NOT NULL,
+				replaced_by TEXT,
+				revoked_at  DATETIME
+			);
+			CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id)`,
+	},
+	{
+		version: 18,
+		name:    "add_revoked_token_expiry",
+		stmt: `ALTER TABLE revoked_tokens ADD COLUMN expires_at DATETIME;
+			DELETE FROM revoked_tokens WHERE id NOT IN (
+				SELECT MIN(id) FROM revoked_tokens GROUP BY revoked_token_id
+			);
+			CREATE UNIQUE INDEX revoked_tokens_revoked_token_id ON revoked_tokens (revoked_token_id);
+			CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at)`,
+	},
+}
+
+func migrate(conn *sql.DB) error {
+	_, err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range sqliteMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(m.stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.version, m.name, time.Now().UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
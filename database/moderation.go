@@ -0,0 +1,147 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	ModerationHideChirp     = "hide_chirp"
+	ModerationRestoreChirp  = "restore_chirp"
+	ModerationDeleteChirp   = "delete_chirp"
+	ModerationSuspendUser   = "suspend_user"
+	ModerationUnsuspendUser = "unsuspend_user"
+)
+
+// ModerationAction is an entry in the moderation audit log. It outlives the
+// chirp it refers to, so ChirpID is not cleared when the chirp is deleted.
+type ModerationAction struct {
+	ID        int       `json:"id"`
+	AdminID   int       `json:"admin_id"`
+	Action    string    `json:"action"`
+	ChirpID   *int      `json:"chirp_id,omitempty"`
+	UserID    *int      `json:"user_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) SetChirpHidden(chirpID int, hidden bool) (Chirp, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	chirp, ok := db.chirps[chirpID]
+	if !ok {
+		return Chirp{}, ErrNotFound
+	}
+
+	chirp.HiddenAt = nil
+	if hidden {
+		now := time.Now().UTC()
+		chirp.HiddenAt = &now
+	}
+	db.chirps[chirp.ID] = chirp
+
+	if err := db.appendJournal(journalEntry{Op: opPutChirp, Chirp: &chirp}); err != nil {
+		return Chirp{}, err
+	}
+
+	return db.hydrateChirp(chirp), nil
+}
+
+func (db *DB) SetUserSuspended(userID int, suspended bool) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	user.SuspendedAt = nil
+	if suspended {
+		now := time.Now().UTC()
+		user.SuspendedAt = &now
+	}
+	db.users[user.ID] = user
+
+	if err := db.appendJournal(journalEntry{Op: opPutUser, User: &user}); err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DB) GetOpenReports() ([]Report, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	reports := []Report{}
+	for _, report := range db.reports {
+		if report.ResolvedAt == nil {
+			reports = append(reports, report)
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+
+	return reports, nil
+}
+
+func (db *DB) ResolveReports(chirpID int) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	now := time.Now().UTC()
+	resolved := 0
+
+	for id, report := range db.reports {
+		if report.ChirpID != chirpID || report.ResolvedAt != nil {
+			continue
+		}
+
+		report.ResolvedAt = &now
+		db.reports[id] = report
+		resolved++
+
+		if err := db.appendJournal(journalEntry{Op: opPutReport, Report: &report}); err != nil {
+			return resolved, err
+		}
+	}
+
+	return resolved, nil
+}
+
+func (db *DB) CreateModerationAction(action ModerationAction) (ModerationAction, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	action.ID = db.nextIDs.ModerationAction
+	action.CreatedAt = time.Now().UTC()
+
+	db.moderationActions[action.ID] = action
+	db.nextIDs.ModerationAction++
+
+	if err := db.appendJournal(journalEntry{Op: opPutModerationAction, ModerationAction: &action}); err != nil {
+		return ModerationAction{}, err
+	}
+
+	return action, nil
+}
+
+func (db *DB) GetModerationActions() ([]ModerationAction, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	actions := make([]ModerationAction, 0, len(db.moderationActions))
+	for _, action := range db.moderationActions {
+		actions = append(actions, action)
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].ID > actions[j].ID
+	})
+
+	return actions, nil
+}
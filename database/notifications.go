@@ -0,0 +1,91 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	NotificationMention = "mention"
+	NotificationLike    = "like"
+	NotificationReply   = "reply"
+	NotificationFollow  = "follow"
+)
+
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Type      string     `json:"type"`
+	ActorID   int        `json:"actor_id"`
+	ChirpID   *int       `json:"chirp_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+func (db *DB) CreateNotification(notification Notification) (Notification, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	notification.ID = db.nextIDs.Notification
+	notification.CreatedAt = time.Now().UTC()
+	notification.ReadAt = nil
+
+	db.notifications[notification.ID] = notification
+	db.nextIDs.Notification++
+
+	if err := db.appendJournal(journalEntry{Op: opPutNotification, Notification: &notification}); err != nil {
+		return Notification{}, err
+	}
+
+	return notification, nil
+}
+
+func (db *DB) GetNotifications(userID int) ([]Notification, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	notifications := []Notification{}
+	for _, notification := range db.notifications {
+		if notification.UserID == userID {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID > notifications[j].ID
+	})
+
+	return notifications, nil
+}
+
+func (db *DB) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	now := time.Now().UTC()
+	marked := 0
+
+	for id, notification := range db.notifications {
+		if notification.UserID != userID || notification.ReadAt != nil {
+			continue
+		}
+		if len(ids) > 0 && !wanted[id] {
+			continue
+		}
+
+		notification.ReadAt = &now
+		db.notifications[id] = notification
+		marked++
+
+		if err := db.appendJournal(journalEntry{Op: opPutNotification, Notification: &notification}); err != nil {
+			return marked, err
+		}
+	}
+
+	return marked, nil
+}
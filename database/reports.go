@@ -0,0 +1,45 @@
+package database
+
+import "time"
+
+// Report asks moderators to review a chirp. Reports raised automatically by
+// the content filter have no reporter.
+type Report struct {
+	ID         int        `json:"id"`
+	ChirpID    int        `json:"chirp_id"`
+	ReporterID *int       `json:"reporter_id,omitempty"`
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+func (db *DB) CreateReport(report Report) (Report, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.chirps[report.ChirpID]; !ok {
+		return Report{}, ErrNotFound
+	}
+
+	if report.ReporterID != nil {
+		for _, existing := range db.reports {
+			if existing.ChirpID == report.ChirpID && existing.ResolvedAt == nil &&
+				existing.ReporterID != nil && *existing.ReporterID == *report.ReporterID {
+				return Report{}, ErrDuplicate
+			}
+		}
+	}
+
+	report.ID = db.nextIDs.Report
+	report.CreatedAt = time.Now().UTC()
+	report.ResolvedAt = nil
+
+	db.reports[report.ID] = report
+	db.nextIDs.Report++
+
+	if err := db.appendJournal(journalEntry{Op: opPutReport, Report: &report}); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
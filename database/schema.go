@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+const currentSchemaVersion = 4
+
+var schemaUpgrades = map[int]func(*DBStructure) error{
+	1: upgradeV1ToV2,
+	2: upgradeV2ToV3,
+	3: upgradeV3ToV4,
+}
+
+func upgradeDBStructure(dbStructure *DBStructure) error {
+	// Files written before the schema_version field existed are version 1.
+	if dbStructure.SchemaVersion == 0 {
+		dbStructure.SchemaVersion = 1
+	}
+
+	if dbStructure.SchemaVersion > currentSchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d",
+			dbStructure.SchemaVersion, currentSchemaVersion)
+	}
+
+	for dbStructure.SchemaVersion < currentSchemaVersion {
+		upgrade, ok := schemaUpgrades[dbStructure.SchemaVersion]
+		if !ok {
+			return fmt.Errorf("no upgrade path from database schema version %d", dbStructure.SchemaVersion)
+		}
+
+		if err := upgrade(dbStructure); err != nil {
+			return fmt.Errorf("upgrading database schema from version %d: %w", dbStructure.SchemaVersion, err)
+		}
+		dbStructure.SchemaVersion++
+	}
+
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = make(map[int]Chirp)
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = make(map[int]User)
+	}
+	if dbStructure.RevokedTokens == nil {
+		dbStructure.RevokedTokens = make(map[int]RevokedToken)
+	}
+	if dbStructure.ChirpRevisions == nil {
+		dbStructure.ChirpRevisions = make(map[int]ChirpRevision)
+	}
+	if dbStructure.Likes == nil {
+		dbStructure.Likes = make(map[int]Like)
+	}
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = make(map[int]Follow)
+	}
+	if dbStructure.Notifications == nil {
+		dbStructure.Notifications = make(map[int]Notification)
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = make(map[int]Report)
+	}
+	if dbStructure.ModerationActions == nil {
+		dbStructure.ModerationActions = make(map[int]ModerationAction)
+	}
+	if dbStructure.Media == nil {
+		dbStructure.Media = make(map[string]Media)
+	}
+	if dbStructure.RefreshTokens == nil {
+		dbStructure.RefreshTokens = make(map[string]RefreshToken)
+	}
+
+	return nil
+}
+
+// Version 1 files were keyed by ID but the embedded records did not always
+// carry it, so the map key is treated as authoritative.
+func upgradeV1ToV2(dbStructure *DBStructure) error {
+	for id, chirp := range dbStructure.Chirps {
+		chirp.ID = id
+		dbStructure.Chirps[id] = chirp
+	}
+	for id, user := range dbStructure.Users {
+		user.ID = id
+		dbStructure.Users[id] = user
+	}
+	for id, revokedToken := range dbStructure.RevokedTokens {
+		revokedToken.ID = id
+		dbStructure.RevokedTokens[id] = revokedToken
+	}
+
+	return nil
+}
+
+// Version 2 revoked tokens had no expiry, so it is read back from the
+// tokens themselves.
+func upgradeV2ToV3(dbStructure *DBStructure) error {
+	now := time.Now()
+	for id, revokedToken := range dbStructure.RevokedTokens {
+		revokedToken.ExpiresAt = tokenExpiry(revokedToken.RevokedTokenID, now)
+		dbStructure.RevokedTokens[id] = revokedToken
+	}
+
+	return nil
+}
+
+// Version 3 files did not store the next IDs, so they start after the
+// highest ID still present. IDs of records deleted before the upgrade may
+// be reused once; none are after it.
+func upgradeV3ToV4(dbStructure *DBStructure) error {
+	dbStructure.NextIDs = NextIDs{
+		Chirp:            findMaxID(dbStructure.Chirps) + 1,
+		User:             findMaxID(dbStructure.Users) + 1,
+		RevokedToken:     findMaxID(dbStructure.RevokedTokens) + 1,
+		ChirpRevision:    findMaxID(dbStructure.ChirpRevisions) + 1,
+		Like:             findMaxID(dbStructure.Likes) + 1,
+		Follow:           findMaxID(dbStructure.Follows) + 1,
+		Notification:     findMaxID(dbStructure.Notifications) + 1,
+		Report:           findMaxID(dbStructure.Reports) + 1,
+		ModerationAction: findMaxID(dbStructure.ModerationActions) + 1,
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type SearchQuery struct {
+	Terms    []string
+	Phrases  [][]string
+	AuthorID *int
+	Hashtags []string
+}
+
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+}
+
+func (q SearchQuery) words() []string {
+	words := append([]string{}, q.Terms...)
+	for _, phrase := range q.Phrases {
+		words = append(words, phrase...)
+	}
+	return words
+}
+
+func (db *DB) indexSearchTerms(chirp Chirp) {
+	for _, token := range Tokenize(chirp.Body) {
+		if db.searchIndex[token] == nil {
+			db.searchIndex[token] = make(map[int]int)
+		}
+		db.searchIndex[token][chirp.ID]++
+	}
+}
+
+func (db *DB) unindexSearchTerms(chirp Chirp) {
+	for _, token := range Tokenize(chirp.Body) {
+		delete(db.searchIndex[token], chirp.ID)
+		if len(db.searchIndex[token]) == 0 {
+			delete(db.searchIndex, token)
+		}
+	}
+}
+
+// searchCandidates returns the IDs in the smallest posting list among the
+// query's words, hashtags and author. Only a query with none of those
+// considers every chirp.
+func (db *DB) searchCandidates(query SearchQuery, words []string) []int {
+	var smallest []int
+	seeded := false
+	consider := func(size int, ids func() []int) {
+		if !seeded || size < len(smallest) {
+			smallest = ids()
+			seeded = true
+		}
+	}
+
+	for _, word := range words {
+		postings := db.searchIndex[word]
+		consider(len(postings), func() []int { return intKeys(postings) })
+	}
+	for _, tag := range query.Hashtags {
+		postings := db.hashtagIndex[tag]
+		consider(len(postings), func() []int { return intKeys(postings) })
+	}
+	if query.AuthorID != nil {
+		postings := db.authorIndex[*query.AuthorID]
+		consider(len(postings), func() []int { return intKeys(postings) })
+	}
+
+	if !seeded {
+		return intKeys(db.chirps)
+	}
+	return smallest
+}
+
+func intKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (db *DB) SearchChirps(query SearchQuery) ([]Chirp, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	words := query.words()
+
+	scores := make(map[int]float64)
+	results := []Chirp{}
+
+candidateLoop:
+	for _, id := range db.searchCandidates(query, words) {
+		chirp := db.chirps[id]
+
+		if query.AuthorID != nil && chirp.AuthorID != *query.AuthorID {
+			continue
+		}
+
+		for _, word := range words {
+			if _, ok := db.searchIndex[word][id]; !ok {
+				continue candidateLoop
+			}
+		}
+
+		for _, tag := range query.Hashtags {
+			if _, ok := db.hashtagIndex[tag][id]; !ok {
+				continue candidateLoop
+			}
+		}
+
+		if len(query.Phrases) > 0 {
+			tokens := Tokenize(chirp.Body)
+			for _, phrase := range query.Phrases {
+				if !containsPhrase(tokens, phrase) {
+					continue candidateLoop
+				}
+			}
+		}
+
+		var score float64
+		for _, word := range words {
+			postings := db.searchIndex[word]
+			idf := math.Log(1 + float64(len(db.chirps))/float64(len(postings)))
+			score += float64(postings[id]) * idf
+		}
+		scores[id] = score
+
+		results = append(results, chirp)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if scores[results[i].ID] != scores[results[j].ID] {
+			return scores[results[i].ID] > scores[results[j].ID]
+		}
+		return results[i].ID > results[j].ID
+	})
+	db.hydrateChirps(results)
+
+	return results, nil
+}
+
+func containsPhrase(tokens []string, phrase []string) bool {
+	if len(phrase) == 0 {
+		return true
+	}
+
+outer:
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		for j, word := range phrase {
+			if tokens[i+j] != word {
+				continue outer
+			}
+		}
+		return true
+	}
+
+	return false
+}
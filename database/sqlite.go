@@ -0,0 +1,1296 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type SQLiteDB struct {
+	conn *sql.DB
+}
+
+var _ Store = (*SQLiteDB)(nil)
+
+const chirpColumns = `c.id, c.body, c.author_id, c.created_at, c.updated_at, c.edited_at, c.hidden_at, c.in_reply_to,
+	c.rechirp_of, c.quoted_chirp_id,
+	(SELECT group_concat(tag, ' ') FROM (SELECT tag FROM chirp_hashtags h WHERE h.chirp_id = c.id ORDER BY h.id)),
+	(SELECT group_concat(user_id, ' ') FROM (SELECT user_id FROM chirp_mentions m WHERE m.chirp_id = c.id ORDER BY m.id)),
+	(SELECT group_concat(media_id, ' ') FROM (SELECT media_id FROM chirp_media cm WHERE cm.chirp_id = c.id ORDER BY cm.position)),
+	(SELECT COUNT(*) FROM chirps r WHERE r.in_reply_to = c.id),
+	(SELECT COUNT(*) FROM likes l WHERE l.chirp_id = c.id),
+	(SELECT COUNT(*) FROM chirps rc WHERE rc.rechirp_of = c.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChirp(row rowScanner) (Chirp, error) {
+	var chirp Chirp
+	var editedAt, hiddenAt sql.NullTime
+	var inReplyTo, rechirpOf, quotedChirpID sql.NullInt64
+	var hashtags, mentions, mediaIDs sql.NullString
+
+	err := row.Scan(
+		&chirp.ID, &chirp.Body, &chirp.AuthorID, &chirp.CreatedAt, &chirp.UpdatedAt, &editedAt, &hiddenAt, &inReplyTo,
+		&rechirpOf, &quotedChirpID, &hashtags, &mentions, &mediaIDs,
+		&chirp.ReplyCount, &chirp.LikeCount, &chirp.RechirpCount,
+	)
+	if editedAt.Valid {
+		chirp.EditedAt = &editedAt.Time
+	}
+	if hiddenAt.Valid {
+		chirp.HiddenAt = &hiddenAt.Time
+	}
+	chirp.InReplyTo = nullIntPtr(inReplyTo)
+	chirp.RechirpOfID = nullIntPtr(rechirpOf)
+	chirp.QuotedChirpID = nullIntPtr(quotedChirpID)
+	if hashtags.Valid {
+		chirp.Hashtags = strings.Fields(hashtags.String)
+	}
+	if mentions.Valid {
+		for _, field := range strings.Fields(mentions.String) {
+			userID, _ := strconv.Atoi(field)
+			chirp.Mentions = append(chirp.Mentions, userID)
+		}
+	}
+	if mediaIDs.Valid {
+		chirp.MediaIDs = strings.Fields(mediaIDs.String)
+	}
+
+	return chirp, err
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+func scanChirps(rows *sql.Rows) ([]Chirp, error) {
+	defer rows.Close()
+
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	return chirps, rows.Err()
+}
+
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	// Foreign keys are set in the DSN so every connection the pool opens
+	// enforces them, not just the first.
+	conn, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := backfillRevokedTokenExpiry(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &SQLiteDB{conn: conn}, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func isChirpyRed(q queryRower, userID int) (bool, error) {
+	var red bool
+	err := q.QueryRow("SELECT is_chirpy_red FROM users WHERE id = ?", userID).Scan(&red)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return red, err
+}
+
+func (s *SQLiteDB) CreateChirp(body string, ID string, opts ChirpOptions) (Chirp, error) {
+	authorID, err := strconv.Atoi(ID)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	red, err := isChirpyRed(s.conn, authorID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if err := validateChirpBody(body, red); err != nil {
+		return Chirp{}, err
+	}
+
+	for _, ref := range []*int{opts.InReplyTo, opts.QuotedChirpID} {
+		if ref == nil {
+			continue
+		}
+		if _, err := s.getChirpRow(*ref); errors.Is(err, ErrNotFound) {
+			return Chirp{}, ErrReferencedChirpNotFound
+		} else if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	for _, mediaID := range opts.MediaIDs {
+		if _, err := s.GetMedia(mediaID); errors.Is(err, ErrNotFound) {
+			return Chirp{}, ErrReferencedMediaNotFound
+		} else if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	result, err := tx.Exec(
+		"INSERT INTO chirps (body, author_id, created_at, updated_at, in_reply_to, quoted_chirp_id) VALUES (?, ?, ?, ?, ?, ?)",
+		body, authorID, now, now, opts.InReplyTo, opts.QuotedChirpID,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	if err := insertHashtags(tx, int(id), opts.Hashtags, now); err != nil {
+		return Chirp{}, err
+	}
+
+	if err := insertMentions(tx, int(id), opts.Mentions); err != nil {
+		return Chirp{}, err
+	}
+
+	for position, mediaID := range opts.MediaIDs {
+		_, err := tx.Exec("INSERT INTO chirp_media (chirp_id, media_id, position) VALUES (?, ?, ?)", id, mediaID, position)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chirp{}, err
+	}
+
+	return s.GetChirp(int(id))
+}
+
+func insertHashtags(tx *sql.Tx, chirpID int, hashtags []string, createdAt time.Time) error {
+	for _, tag := range hashtags {
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO chirp_hashtags (chirp_id, tag, created_at) VALUES (?, ?, ?)",
+			chirpID, tag, createdAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertMentions(tx *sql.Tx, chirpID int, mentions []int) error {
+	for _, userID := range mentions {
+		_, err := tx.Exec("INSERT OR IGNORE INTO chirp_mentions (chirp_id, user_id) VALUES (?, ?)", chirpID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) Rechirp(chirpID int, userID int) (Chirp, error) {
+	original, err := s.getChirpRow(chirpID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if original.RechirpOfID != nil {
+		if original, err = s.getChirpRow(*original.RechirpOfID); err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+
+	result, err := s.conn.Exec(
+		"INSERT OR IGNORE INTO chirps (body, author_id, created_at, updated_at, rechirp_of) VALUES ('', ?, ?, ?, ?)",
+		userID, now, now, original.ID,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return Chirp{}, ErrDuplicate
+	} else if err != nil {
+		return Chirp{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return s.GetChirp(int(id))
+}
+
+func (s *SQLiteDB) GetChirps() ([]Chirp, error) {
+	rows, err := s.conn.Query("SELECT " + chirpColumns + " FROM chirps c ORDER BY c.id")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanAndExpandChirps(rows)
+}
+
+func (s *SQLiteDB) GetChirp(id int) (Chirp, error) {
+	chirp, err := s.getChirpRow(id)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirps := []Chirp{chirp}
+	if err := expandChirpRefs(chirps, s.getChirpRow); err != nil {
+		return Chirp{}, err
+	}
+
+	return chirps[0], nil
+}
+
+func (s *SQLiteDB) getChirpRow(id int) (Chirp, error) {
+	chirp, err := scanChirp(s.conn.QueryRow("SELECT "+chirpColumns+" FROM chirps c WHERE c.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, ErrNotFound
+	}
+
+	return chirp, err
+}
+
+func (s *SQLiteDB) scanAndExpandChirps(rows *sql.Rows) ([]Chirp, error) {
+	chirps, err := scanChirps(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := expandChirpRefs(chirps, s.getChirpRow); err != nil {
+		return nil, err
+	}
+
+	return chirps, nil
+}
+
+func (s *SQLiteDB) DeleteChirp(id int) error {
+	result, err := s.conn.Exec("DELETE FROM chirps WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+func (s *SQLiteDB) UpdateChirp(id int, body string, hashtags []string, mentions []int) (Chirp, error) {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := scanChirp(tx.QueryRow("SELECT "+chirpColumns+" FROM chirps c WHERE c.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, ErrNotFound
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	red, err := isChirpyRed(tx, chirp.AuthorID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if err := validateChirpBody(body, red); err != nil {
+		return Chirp{}, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO chirp_revisions (chirp_id, body, created_at) VALUES (?, ?, ?)",
+		chirp.ID, chirp.Body, chirp.UpdatedAt,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	now := time.Now().UTC()
+	chirp.Body = body
+	chirp.UpdatedAt = now
+	chirp.EditedAt = &now
+
+	_, err = tx.Exec(
+		"UPDATE chirps SET body = ?, updated_at = ?, edited_at = ? WHERE id = ?",
+		chirp.Body, chirp.UpdatedAt, chirp.EditedAt, chirp.ID,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM chirp_hashtags WHERE chirp_id = ?", chirp.ID); err != nil {
+		return Chirp{}, err
+	}
+	if err := insertHashtags(tx, chirp.ID, hashtags, chirp.CreatedAt); err != nil {
+		return Chirp{}, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM chirp_mentions WHERE chirp_id = ?", chirp.ID); err != nil {
+		return Chirp{}, err
+	}
+	if err := insertMentions(tx, chirp.ID, mentions); err != nil {
+		return Chirp{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chirp{}, err
+	}
+
+	return s.GetChirp(chirp.ID)
+}
+
+func (s *SQLiteDB) GetChirpRevisions(chirpID int) ([]ChirpRevision, error) {
+	if _, err := s.GetChirp(chirpID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query(
+		"SELECT id, chirp_id, body, created_at FROM chirp_revisions WHERE chirp_id = ? ORDER BY id",
+		chirpID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ChirpRevision{}
+	for rows.Next() {
+		var revision ChirpRevision
+		if err := rows.Scan(&revision.ID, &revision.ChirpID, &revision.Body, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *SQLiteDB) GetReplies(chirpID int) ([]Chirp, error) {
+	if _, err := s.GetChirp(chirpID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query("SELECT "+chirpColumns+" FROM chirps c WHERE c.in_reply_to = ? ORDER BY c.id", chirpID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanAndExpandChirps(rows)
+}
+
+func (s *SQLiteDB) LikeChirp(chirpID int, userID int) error {
+	if _, err := s.GetChirp(chirpID); err != nil {
+		return err
+	}
+
+	result, err := s.conn.Exec(
+		"INSERT OR IGNORE INTO likes (chirp_id, user_id, created_at) VALUES (?, ?, ?)",
+		chirpID, userID, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) UnlikeChirp(chirpID int, userID int) error {
+	result, err := s.conn.Exec("DELETE FROM likes WHERE chirp_id = ? AND user_id = ?", chirpID, userID)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+func (s *SQLiteDB) GetLikedChirpIDs(userID int) (map[int]bool, error) {
+	rows, err := s.conn.Query("SELECT chirp_id FROM likes WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	liked := make(map[int]bool)
+	for rows.Next() {
+		var chirpID int
+		if err := rows.Scan(&chirpID); err != nil {
+			return nil, err
+		}
+		liked[chirpID] = true
+	}
+
+	return liked, rows.Err()
+}
+
+func (s *SQLiteDB) Follow(followerID int, followeeID int) error {
+	if err := s.requireUser(followeeID); err != nil {
+		return err
+	}
+
+	result, err := s.conn.Exec(
+		"INSERT OR IGNORE INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)",
+		followerID, followeeID, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) Unfollow(followerID int, followeeID int) error {
+	result, err := s.conn.Exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(result)
+}
+
+func (s *SQLiteDB) GetFollowers(userID int) ([]Follow, error) {
+	return s.queryFollows(userID, "followee_id")
+}
+
+func (s *SQLiteDB) GetFollowing(userID int) ([]Follow, error) {
+	return s.queryFollows(userID, "follower_id")
+}
+
+func (s *SQLiteDB) queryFollows(userID int, column string) ([]Follow, error) {
+	if err := s.requireUser(userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query(
+		"SELECT id, follower_id, followee_id, created_at FROM follows WHERE "+column+" = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []Follow{}
+	for rows.Next() {
+		var follow Follow
+		if err := rows.Scan(&follow.ID, &follow.FollowerID, &follow.FolloweeID, &follow.CreatedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, follow)
+	}
+
+	return follows, rows.Err()
+}
+
+func (s *SQLiteDB) GetChirpsByAuthors(authorIDs []int) ([]Chirp, error) {
+	if len(authorIDs) == 0 {
+		return []Chirp{}, nil
+	}
+
+	placeholders := strings.Repeat("?, ", len(authorIDs)-1) + "?"
+	args := make([]interface{}, len(authorIDs))
+	for i, id := range authorIDs {
+		args[i] = id
+	}
+
+	rows, err := s.conn.Query(
+		"SELECT "+chirpColumns+" FROM chirps c WHERE c.author_id IN ("+placeholders+") ORDER BY c.id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanAndExpandChirps(rows)
+}
+
+func (s *SQLiteDB) GetChirpsByHashtag(tag string) ([]Chirp, error) {
+	rows, err := s.conn.Query(
+		"SELECT "+chirpColumns+" FROM chirps c WHERE c.id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = ?) ORDER BY c.id",
+		tag,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanAndExpandChirps(rows)
+}
+
+func (s *SQLiteDB) GetTrendingHashtags(since time.Time, limit int) ([]HashtagCount, error) {
+	rows, err := s.conn.Query(
+		`SELECT h.tag, COUNT(*) FROM chirp_hashtags h
+		JOIN chirps c ON c.id = h.chirp_id
+		WHERE h.created_at >= ? AND c.hidden_at IS NULL
+		GROUP BY h.tag ORDER BY COUNT(*) DESC, h.tag LIMIT ?`,
+		since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trending := []HashtagCount{}
+	for rows.Next() {
+		var count HashtagCount
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		trending = append(trending, count)
+	}
+
+	return trending, rows.Err()
+}
+
+func (s *SQLiteDB) CreateNotification(notification Notification) (Notification, error) {
+	notification.CreatedAt = time.Now().UTC()
+	notification.ReadAt = nil
+
+	result, err := s.conn.Exec(
+		"INSERT INTO notifications (user_id, type, actor_id, chirp_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		notification.UserID, notification.Type, notification.ActorID, notification.ChirpID, notification.CreatedAt,
+	)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Notification{}, err
+	}
+	notification.ID = int(id)
+
+	return notification, nil
+}
+
+func (s *SQLiteDB) GetNotifications(userID int) ([]Notification, error) {
+	rows, err := s.conn.Query(
+		`SELECT id, user_id, type, actor_id, chirp_id, created_at, read_at FROM notifications
+		WHERE user_id = ? ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var chirpID sql.NullInt64
+		var readAt sql.NullTime
+
+		err := rows.Scan(
+			&notification.ID, &notification.UserID, &notification.Type, &notification.ActorID,
+			&chirpID, &notification.CreatedAt, &readAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		notification.ChirpID = nullIntPtr(chirpID)
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *SQLiteDB) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	query := "UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{time.Now().UTC(), userID}
+
+	if len(ids) > 0 {
+		query += " AND id IN (" + strings.Repeat("?, ", len(ids)-1) + "?)"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := s.conn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteDB) SearchChirps(query SearchQuery) ([]Chirp, error) {
+	from := "chirps c"
+	var where []string
+	var args []interface{}
+	orderBy := "c.id DESC"
+
+	var match []string
+	for _, term := range query.Terms {
+		match = append(match, `"`+term+`"`)
+	}
+	for _, phrase := range query.Phrases {
+		match = append(match, `"`+strings.Join(phrase, " ")+`"`)
+	}
+
+	if len(match) > 0 {
+		from = "chirps_fts JOIN chirps c ON c.id = chirps_fts.rowid"
+		where = append(where, "chirps_fts MATCH ?")
+		args = append(args, strings.Join(match, " "))
+		orderBy = "bm25(chirps_fts), c.id DESC"
+	}
+
+	if query.AuthorID != nil {
+		where = append(where, "c.author_id = ?")
+		args = append(args, *query.AuthorID)
+	}
+
+	for _, tag := range query.Hashtags {
+		where = append(where, "c.id IN (SELECT chirp_id FROM chirp_hashtags WHERE tag = ?)")
+		args = append(args, tag)
+	}
+
+	sqlQuery := "SELECT " + chirpColumns + " FROM " + from
+	if len(where) > 0 {
+		sqlQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	sqlQuery += " ORDER BY " + orderBy
+
+	rows, err := s.conn.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanAndExpandChirps(rows)
+}
+
+func (s *SQLiteDB) CreateMedia(media Media) (Media, error) {
+	media.CreatedAt = time.Now().UTC()
+
+	_, err := s.conn.Exec(
+		"INSERT OR IGNORE INTO media (id, owner_id, content_type, size, width, height, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		media.ID, media.OwnerID, media.ContentType, media.Size, media.Width, media.Height, media.CreatedAt,
+	)
+	if err != nil {
+		return Media{}, err
+	}
+
+	return s.GetMedia(media.ID)
+}
+
+func (s *SQLiteDB) GetMedia(id string) (Media, error) {
+	var media Media
+	err := s.conn.QueryRow(
+		"SELECT id, owner_id, content_type, size, width, height, created_at FROM media WHERE id = ?", id,
+	).Scan(&media.ID, &media.OwnerID, &media.ContentType, &media.Size, &media.Width, &media.Height, &media.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Media{}, ErrNotFound
+	}
+
+	return media, err
+}
+
+func (s *SQLiteDB) CreateReport(report Report) (Report, error) {
+	if _, err := s.getChirpRow(report.ChirpID); err != nil {
+		return Report{}, err
+	}
+
+	if report.ReporterID != nil {
+		var exists bool
+		err := s.conn.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM reports WHERE chirp_id = ? AND reporter_id = ? AND resolved_at IS NULL)",
+			report.ChirpID, *report.ReporterID,
+		).Scan(&exists)
+		if err != nil {
+			return Report{}, err
+		}
+		if exists {
+			return Report{}, ErrDuplicate
+		}
+	}
+
+	report.CreatedAt = time.Now().UTC()
+	report.ResolvedAt = nil
+
+	result, err := s.conn.Exec(
+		"INSERT INTO reports (chirp_id, reporter_id, reason, created_at) VALUES (?, ?, ?, ?)",
+		report.ChirpID, report.ReporterID, report.Reason, report.CreatedAt,
+	)
+	if err != nil {
+		return Report{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Report{}, err
+	}
+	report.ID = int(id)
+
+	return report, nil
+}
+
+func (s *SQLiteDB) GetOpenReports() ([]Report, error) {
+	rows, err := s.conn.Query(
+		"SELECT id, chirp_id, reporter_id, reason, created_at FROM reports WHERE resolved_at IS NULL ORDER BY id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var report Report
+		var reporterID sql.NullInt64
+		if err := rows.Scan(&report.ID, &report.ChirpID, &reporterID, &report.Reason, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		report.ReporterID = nullIntPtr(reporterID)
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+func (s *SQLiteDB) ResolveReports(chirpID int) (int, error) {
+	result, err := s.conn.Exec(
+		"UPDATE reports SET resolved_at = ? WHERE chirp_id = ? AND resolved_at IS NULL",
+		time.Now().UTC(), chirpID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteDB) SetChirpHidden(chirpID int, hidden bool) (Chirp, error) {
+	var hiddenAt *time.Time
+	if hidden {
+		now := time.Now().UTC()
+		hiddenAt = &now
+	}
+
+	result, err := s.conn.Exec("UPDATE chirps SET hidden_at = ? WHERE id = ?", hiddenAt, chirpID)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if err := requireAffected(result); err != nil {
+		return Chirp{}, err
+	}
+
+	return s.GetChirp(chirpID)
+}
+
+func (s *SQLiteDB) SetUserSuspended(userID int, suspended bool) (User, error) {
+	var suspendedAt *time.Time
+	if suspended {
+		now := time.Now().UTC()
+		suspendedAt = &now
+	}
+
+	result, err := s.conn.Exec("UPDATE users SET suspended_at = ? WHERE id = ?", suspendedAt, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if err := requireAffected(result); err != nil {
+		return User{}, err
+	}
+
+	return s.GetUser(userID)
+}
+
+func (s *SQLiteDB) CreateModerationAction(action ModerationAction) (ModerationAction, error) {
+	action.CreatedAt = time.Now().UTC()
+
+	result, err := s.conn.Exec(
+		"INSERT INTO moderation_actions (admin_id, action, chirp_id, user_id, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		action.AdminID, action.Action, action.ChirpID, action.UserID, action.Reason, action.CreatedAt,
+	)
+	if err != nil {
+		return ModerationAction{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ModerationAction{}, err
+	}
+	action.ID = int(id)
+
+	return action, nil
+}
+
+func (s *SQLiteDB) GetModerationActions() ([]ModerationAction, error) {
+	rows, err := s.conn.Query(
+		"SELECT id, admin_id, action, chirp_id, user_id, reason, created_at FROM moderation_actions ORDER BY id DESC",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []ModerationAction{}
+	for rows.Next() {
+		var action ModerationAction
+		var chirpID, userID sql.NullInt64
+		if err := rows.Scan(
+			&action.ID, &action.AdminID, &action.Action, &chirpID, &userID, &action.Reason, &action.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		action.ChirpID = nullIntPtr(chirpID)
+		action.UserID = nullIntPtr(userID)
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+func (s *SQLiteDB) requireUser(userID int) error {
+	var exists bool
+	if err := s.conn.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+const userColumns = "id, email, password, is_chirpy_red, username, display_name, bio, avatar, suspended_at"
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var username sql.NullString
+	var suspendedAt sql.NullTime
+	if err := row.Scan(
+		&user.ID, &user.Email, &user.Password, &user.IsChirpyRed,
+		&username, &user.DisplayName, &user.Bio, &user.Avatar, &suspendedAt,
+	); err != nil {
+		return User{}, err
+	}
+	user.Username = username.String
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+
+	return user, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *SQLiteDB) usernameTaken(username string, exceptUserID int) (bool, error) {
+	if username == "" {
+		return false, nil
+	}
+
+	var taken bool
+	err := s.conn.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM users WHERE username = ? AND id != ?)",
+		username, exceptUserID,
+	).Scan(&taken)
+
+	return taken, err
+}
+
+func (s *SQLiteDB) CreateUser(email string, password string, username string) (UserResponse, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	var exists bool
+	if err := s.conn.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)", email).Scan(&exists); err != nil {
+		return UserResponse{}, err
+	}
+	if exists {
+		return UserResponse{}, errors.New("email already in use")
+	}
+
+	username = NormalizeUsername(username)
+	taken, err := s.usernameTaken(username, 0)
+	if err != nil {
+		return UserResponse{}, err
+	}
+	if taken {
+		return UserResponse{}, ErrDuplicate
+	}
+
+	result, err := s.conn.Exec(
+		"INSERT INTO users (email, password, is_chirpy_red, username) VALUES (?, ?, ?, ?)",
+		email, string(hashedPassword), false, nullString(username),
+	)
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return UserResponse{}, err
+	}
+
+	return UserResponse{
+		ID:          int(id),
+		Email:       email,
+		IsChirpyRed: false,
+		Username:    username,
+	}, nil
+}
+
+func (s *SQLiteDB) GetUsers() ([]User, error) {
+	rows, err := s.conn.Query("SELECT " + userColumns + " FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *SQLiteDB) GetUser(userID int) (User, error) {
+	user, err := scanUser(s.conn.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+
+	return user, err
+}
+
+func (s *SQLiteDB) GetUserByUsername(username string) (User, error) {
+	username = NormalizeUsername(username)
+	if username == "" {
+		return User{}, ErrNotFound
+	}
+
+	user, err := scanUser(s.conn.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ?", username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+
+	return user, err
+}
+
+func (s *SQLiteDB) UpdateProfile(userID int, profile Profile) (User, error) {
+	username := NormalizeUsername(profile.Username)
+	taken, err := s.usernameTaken(username, userID)
+	if err != nil {
+		return User{}, err
+	}
+	if taken {
+		return User{}, ErrDuplicate
+	}
+
+	result, err := s.conn.Exec(
+		"UPDATE users SET username = ?, display_name = ?, bio = ?, avatar = ? WHERE id = ?",
+		nullString(username), profile.DisplayName, profile.Bio, profile.Avatar, userID,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	if err := requireAffected(result); err != nil {
+		return User{}, err
+	}
+
+	return s.GetUser(userID)
+}
+
+func (s *SQLiteDB) UpdateUser(userID int, email string, password string, ischirpyred bool, usingWebhook bool) (User, error) {
+	if !usingWebhook {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return User{}, err
+		}
+		password = string(hashedPassword)
+	}
+
+	_, err := s.conn.Exec(
+		"UPDATE users SET email = ?, password = ?, is_chirpy_red = ? WHERE id = ?",
+		email, password, ischirpyred, userID,
+	)
+	if isUniqueViolation(err) {
+		return User{}, ErrDuplicate
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return s.GetUser(userID)
+}
+
+func (s *SQLiteDB) StoreRevokedToken(tokenID string, expiresAt time.Time) error {
+	result, err := s.conn.Exec(
+		"INSERT INTO revoked_tokens (revoked_token_id, expires_at) VALUES (?, ?) ON CONFLICT (revoked_token_id) DO NOTHING",
+		tokenID, expiresAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) IsTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := s.conn.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE revoked_token_id = ?)", tokenID,
+	).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *SQLiteDB) PurgeExpiredRevokedTokens(now time.Time) (int, error) {
+	result, err := s.conn.Exec("DELETE FROM revoked_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteDB) CountRevokedTokens() (int, error) {
+	var count int
+	err := s.conn.QueryRow("SELECT COUNT(*) FROM revoked_tokens").Scan(&count)
+	return count, err
+}
+
+// backfillRevokedTokenExpiry fills in expires_at for rows revoked before
+// the column existed.
+func backfillRevokedTokenExpiry(conn *sql.DB) error {
+	rows, err := conn.Query("SELECT id, revoked_token_id FROM revoked_tokens WHERE expires_at IS NULL")
+	if err != nil {
+		return err
+	}
+
+	expiries := map[int]time.Time{}
+	now := time.Now()
+	for rows.Next() {
+		var id int
+		var tokenID string
+		if err := rows.Scan(&id, &tokenID); err != nil {
+			rows.Close()
+			return err
+		}
+		expiries[id] = tokenExpiry(tokenID, now)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, expiresAt := range expiries {
+		if _, err := conn.Exec("UPDATE revoked_tokens SET expires_at = ? WHERE id = ?", expiresAt, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) CreateRefreshToken(token RefreshToken) error {
+	result, err := s.conn.Exec(
+		"INSERT OR IGNORE INTO refresh_tokens (id, family_id, user_id, issued_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.FamilyID, token.UserID, token.IssuedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SQLiteDB) GetRefreshToken(id string) (RefreshToken, error) {
+	token := RefreshToken{ID: id}
+	var replacedBy sql.NullString
+	var revokedAt sql.NullTime
+	err := s.conn.QueryRow(
+		"SELECT family_id, user_id, issued_at, expires_at, replaced_by, revoked_at FROM refresh_tokens WHERE id = ?", id,
+	).Scan(&token.FamilyID, &token.UserID, &token.IssuedAt, &token.ExpiresAt, &replacedBy, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrNotFound
+	} else if err != nil {
+		return RefreshToken{}, err
+	}
+
+	token.ReplacedBy = replacedBy.String
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+func (s *SQLiteDB) RotateRefreshToken(id string, next RefreshToken) error {
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID string
+	var userID int
+	var replacedBy sql.NullString
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT family_id, user_id, replaced_by, revoked_at FROM refresh_tokens WHERE id = ?", id,
+	).Scan(&familyID, &userID, &replacedBy, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if revokedAt.Valid {
+		return ErrRefreshTokenRevoked
+	}
+	if replacedBy.Valid {
+		if err := revokeRefreshTokenFamily(tx, familyID); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET replaced_by = ? WHERE id = ?", next.ID, id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"INSERT OR IGNORE INTO refresh_tokens (id, family_id, user_id, issued_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		next.ID, familyID, userID, next.IssuedAt, next.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); errors.Is(err, ErrNotFound) {
+		return ErrDuplicate
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) PurgeExpiredRefreshTokens(now time.Time) (int, error) {
+	result, err := s.conn.Exec("DELETE FROM refresh_tokens WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *SQLiteDB) RevokeRefreshTokenFamily(familyID string) error {
+	return revokeRefreshTokenFamily(s.conn, familyID)
+}
+
+func revokeRefreshTokenFamily(e execer, familyID string) error {
+	_, err := e.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		time.Now().UTC(), familyID,
+	)
+	return err
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound                = errors.New("not found")
+	ErrReferencedChirpNotFound = errors.New("referenced chirp does not exist")
+	ErrDuplicate               = errors.New("already exists")
+	ErrReferencedMediaNotFound = errors.New("referenced media does not exist")
+	ErrRefreshTokenReused      = errors.New("refresh token was already used")
+	ErrRefreshTokenRevoked     = errors.New("refresh token was revoked")
+)
+
+type Store interface {
+	CreateChirp(body string, ID string, opts ChirpOptions) (Chirp, error)
+	GetChirps() ([]Chirp, error)
+	GetChirp(id int) (Chirp, error)
+	UpdateChirp(id int, body string, hashtags []string, mentions []int) (Chirp, error)
+	DeleteChirp(id int) error
+	GetChirpRevisions(chirpID int) ([]ChirpRevision, error)
+	GetReplies(chirpID int) ([]Chirp, error)
+	Rechirp(chirpID int, userID int) (Chirp, error)
+
+	LikeChirp(chirpID int, userID int) error
+	UnlikeChirp(chirpID int, userID int) error
+	GetLikedChirpIDs(userID int) (map[int]bool, error)
+
+	Follow(followerID int, followeeID int) error
+	Unfollow(followerID int, followeeID int) error
+	GetFollowers(userID int) ([]Follow, error)
+	GetFollowing(userID int) ([]Follow, error)
+	GetChirpsByAuthors(authorIDs []int) ([]Chirp, error)
+
+	GetChirpsByHashtag(tag string) ([]Chirp, error)
+	GetTrendingHashtags(since time.Time, limit int) ([]HashtagCount, error)
+	SearchChirps(query SearchQuery) ([]Chirp, error)
+	CreateMedia(media Media) (Media, error)
+	GetMedia(id string) (Media, error)
+	CreateReport(report Report) (Report, error)
+	GetOpenReports() ([]Report, error)
+	ResolveReports(chirpID int) (int, error)
+	SetChirpHidden(chirpID int, hidden bool) (Chirp, error)
+	SetUserSuspended(userID int, suspended bool) (User, error)
+	CreateModerationAction(action ModerationAction) (ModerationAction, error)
+	GetModerationActions() ([]ModerationAction, error)
+
+	CreateNotification(notification Notification) (Notification, error)
+	GetNotifications(userID int) ([]Notification, error)
+	MarkNotificationsRead(userID int, ids []int) (int, error)
+
+	CreateUser(email string, password string, username string) (UserResponse, error)
+	GetUsers() ([]User, error)
+	GetUser(userID int) (User, error)
+	GetUserByUsername(username string) (User, error)
+	UpdateProfile(userID int, profile Profile) (User, error)
+	UpdateUser(userID int, email string, password string, ischirpyred bool, usingWebhook bool) (User, error)
+
+	StoreRevokedToken(tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+	PurgeExpiredRevokedTokens(now time.Time) (int, error)
+	CountRevokedTokens() (int, error)
+	CreateRefreshToken(token RefreshToken) error
+	GetRefreshToken(id string) (RefreshToken, error)
+	RotateRefreshToken(id string, next RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	PurgeExpiredRefreshTokens(now time.Time) (int, error)
+
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
@@ -1,37 +1,237 @@
 package database
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// legacyRevokedTokenLifetime bounds how long a revoked token whose expiry
+// can't be read is kept: no refresh token has ever outlived it.
+const legacyRevokedTokenLifetime = 60 * (24 * time.Hour)
+
+// RevokedToken is kept until the token it revokes has expired; after that
+// the token is rejected anyway and the entry can be purged.
 type RevokedToken struct {
-	ID             int    `json:"id"`
-	RevokedTokenID string `json:"revoked_token_id"`
+	ID             int       `json:"id"`
+	RevokedTokenID string    `json:"revoked_token_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
 }
 
-func (db *DB) StoreRevokedToken(tokenID string) error {
+// StoreRevokedToken adds tokenID to the revoked list. It returns
+// ErrDuplicate if the token was already on it, so callers can use the
+// insert itself to make sure a token is only ever exchanged once.
+func (db *DB) StoreRevokedToken(tokenID string, expiresAt time.Time) error {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
+	if _, ok := db.revokedTokenIndex[tokenID]; ok {
+		return ErrDuplicate
+	}
+
 	revokedToken := RevokedToken{
-		ID:             db.nextRevokedTokenID,
+		ID:             db.nextIDs.RevokedToken,
 		RevokedTokenID: tokenID,
+		ExpiresAt:      expiresAt.UTC(),
 	}
 
 	db.revokedTokens[revokedToken.ID] = revokedToken
-	db.nextRevokedTokenID++
+	db.revokedTokenIndex[tokenID] = revokedToken.ID
+	db.nextIDs.RevokedToken++
 
-	if err := db.writeDB(); err != nil {
+	if err := db.appendJournal(journalEntry{Op: opPutRevokedToken, RevokedToken: &revokedToken}); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (db *DB) GetRevokedTokens() ([]RevokedToken, error) {
+func (db *DB) IsTokenRevoked(tokenID string) (bool, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	_, ok := db.revokedTokenIndex[tokenID]
+	return ok, nil
+}
+
+// PurgeExpiredRevokedTokens drops entries whose token expired at or before
+// now and returns how many were removed.
+func (db *DB) PurgeExpiredRevokedTokens(now time.Time) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	purged := 0
+	for id, revokedToken := range db.revokedTokens {
+		if revokedToken.ExpiresAt.After(now) {
+			continue
+		}
+
+		delete(db.revokedTokens, id)
+		delete(db.revokedTokenIndex, revokedToken.RevokedTokenID)
+		purged++
+
+		if err := db.appendJournal(journalEntry{Op: opDeleteRevokedToken, RevokedToken: &revokedToken}); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+func (db *DB) CountRevokedTokens() (int, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	return len(db.revokedTokens), nil
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, for
+// revoked entries stored before their expiry was recorded. When it can't
+// be read the entry is kept for the longest lifetime a token ever had.
+func tokenExpiry(token string, now time.Time) time.Time {
+	fallback := now.Add(legacyRevokedTokenLifetime).UTC()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fallback
+	}
+
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ExpiresAt == 0 {
+		return fallback
+	}
+
+	return time.Unix(claims.ExpiresAt, 0).UTC()
+}
+
+// RefreshToken tracks an issued refresh token by its jti. Every refresh
+// replaces the token with a new one in the same family; presenting a
+// replaced token again means it leaked, so the whole family is revoked.
+type RefreshToken struct {
+	ID         string     `json:"id"`
+	FamilyID   string     `json:"family_id"`
+	UserID     int        `json:"user_id"`
+	IssuedAt   time.Time  `json:"issued_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ReplacedBy string     `json:"replaced_by,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (db *DB) CreateRefreshToken(token RefreshToken) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	if _, ok := db.refreshTokens[token.ID]; ok {
+		return ErrDuplicate
+	}
+
+	return db.putRefreshToken(token)
+}
+
+func (db *DB) GetRefreshToken(id string) (RefreshToken, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
 
-	revokedTokens := make([]RevokedToken, 0, len(db.revokedTokens))
-	for _, revokedToken := range db.revokedTokens {
-		revokedTokens = append(revokedTokens, revokedToken)
+	token, ok := db.refreshTokens[id]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken marks the token id as replaced by next, which joins
+// the same family. It returns ErrRefreshTokenRevoked if the family was
+// revoked, and ErrRefreshTokenReused (after revoking the family) if id was
+// already replaced.
+func (db *DB) RotateRefreshToken(id string, next RefreshToken) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	current, ok := db.refreshTokens[id]
+	if !ok {
+		return ErrNotFound
 	}
+	if current.RevokedAt != nil {
+		return ErrRefreshTokenRevoked
+	}
+	if current.ReplacedBy != "" {
+		if err := db.revokeRefreshTokenFamily(current.FamilyID); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	if _, ok := db.refreshTokens[next.ID]; ok {
+		return ErrDuplicate
+	}
+
+	current.ReplacedBy = next.ID
+	if err := db.putRefreshToken(current); err != nil {
+		return err
+	}
+
+	next.FamilyID = current.FamilyID
+	next.UserID = current.UserID
+
+	return db.putRefreshToken(next)
+}
+
+func (db *DB) RevokeRefreshTokenFamily(familyID string) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	return db.revokeRefreshTokenFamily(familyID)
+}
+
+func (db *DB) revokeRefreshTokenFamily(familyID string) error {
+	now := time.Now().UTC()
+	for _, token := range db.refreshTokens {
+		if token.FamilyID != familyID || token.RevokedAt != nil {
+			continue
+		}
+		token.RevokedAt = &now
+		if err := db.putRefreshToken(token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeExpiredRefreshTokens drops refresh tokens that expired at or before
+// now; they are refused on their exp claim alone, so their records are no
+// longer needed for rotation or reuse detection.
+func (db *DB) PurgeExpiredRefreshTokens(now time.Time) (int, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	purged := 0
+	for id, token := range db.refreshTokens {
+		if token.ExpiresAt.After(now) {
+			continue
+		}
+
+		delete(db.refreshTokens, id)
+		purged++
+
+		if err := db.appendJournal(journalEntry{Op: opDeleteRefreshToken, RefreshToken: &token}); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+func (db *DB) putRefreshToken(token RefreshToken) error {
+	db.refreshTokens[token.ID] = token
 
-	return revokedTokens, nil
+	return db.appendJournal(journalEntry{Op: opPutRefreshToken, RefreshToken: &token})
 }
@@ -2,6 +2,8 @@ package database
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -11,15 +13,69 @@ type User struct {
 	Email       string `json:"email"`
 	Password    string `json:"password"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
 }
 
 type UserResponse struct {
 	ID          int    `json:"id"`
 	Email       string `json:"email"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+}
+
+type Profile struct {
+	Username    string
+	DisplayName string
+	Bio         string
+	Avatar      string
+}
+
+func (user User) Response() UserResponse {
+	return UserResponse{
+		ID:          user.ID,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Avatar:      user.Avatar,
+		SuspendedAt: user.SuspendedAt,
+	}
+}
+
+// NormalizeUsername lowercases a username and drops surrounding whitespace
+// and a leading @, so "@Alice " and "alice" name the same user.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+func (db *DB) usernameTaken(username string, exceptUserID int) bool {
+	if username == "" {
+		return false
+	}
+
+	for _, user := range db.users {
+		if user.ID != exceptUserID && user.Username == username {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (db *DB) CreateUser(email string, password string) (UserResponse, error) {
+func (db *DB) CreateUser(email string, password string, username string) (UserResponse, error) {
 	db.mux.Lock()
 	defer db.mux.Unlock()
 
@@ -29,16 +85,11 @@ func (db *DB) CreateUser(email string, password string) (UserResponse, error) {
 	}
 
 	user := User{
-		ID:          db.nextUserID,
+		ID:          db.nextIDs.User,
 		Email:       email,
 		Password:    string(hashedPassword),
 		IsChirpyRed: false,
-	}
-
-	userResponse := UserResponse{
-		ID:          db.nextUserID,
-		Email:       email,
-		IsChirpyRed: false,
+		Username:    NormalizeUsername(username),
 	}
 
 	for _, userData := range db.users {
@@ -47,15 +98,19 @@ func (db *DB) CreateUser(email string, password string) (UserResponse, error) {
 		}
 	}
 
+	if db.usernameTaken(user.Username, user.ID) {
+		return UserResponse{}, ErrDuplicate
+	}
+
 	db.users[user.ID] = user
 
-	db.nextUserID++
+	db.nextIDs.User++
 
-	if err := db.writeDB(); err != nil {
+	if err := db.appendJournal(journalEntry{Op: opPutUser, User: &user}); err != nil {
 		return UserResponse{}, err
 	}
 
-	return userResponse, nil
+	return user.Response(), nil
 }
 
 func (db *DB) GetUsers() ([]User, error) {
@@ -70,10 +125,67 @@ func (db *DB) GetUsers() ([]User, error) {
 	return users, nil
 }
 
-func (db *DB) UpdateUser(userID int, email string, password string, ischirpyred bool, usingWebhook bool) (User, error) {
+func (db *DB) GetUser(userID int) (User, error) {
+	db.mux.RLock()
+	defer db.mux.RUnlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (db *DB) GetUserByUsername(username string) (User, error) {
 	db.mux.RLock()
 	defer db.mux.RUnlock()
 
+	username = NormalizeUsername(username)
+	if username == "" {
+		return User{}, ErrNotFound
+	}
+
+	for _, user := range db.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (db *DB) UpdateProfile(userID int, profile Profile) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	user.Username = NormalizeUsername(profile.Username)
+	user.DisplayName = profile.DisplayName
+	user.Bio = profile.Bio
+	user.Avatar = profile.Avatar
+
+	if db.usernameTaken(user.Username, user.ID) {
+		return User{}, ErrDuplicate
+	}
+
+	db.users[userID] = user
+
+	if err := db.appendJournal(journalEntry{Op: opPutUser, User: &user}); err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (db *DB) UpdateUser(userID int, email string, password string, ischirpyred bool, usingWebhook bool) (User, error) {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+
 	if !usingWebhook {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
@@ -82,14 +194,23 @@ func (db *DB) UpdateUser(userID int, email string, password string, ischirpyred
 		password = string(hashedPassword)
 	}
 
-	user := User{
-		ID:          userID,
-		Email:       email,
-		Password:    password,
-		IsChirpyRed: ischirpyred,
+	for _, userData := range db.users {
+		if userData.ID != userID && userData.Email == email {
+			return User{}, ErrDuplicate
+		}
 	}
 
+	user := db.users[userID]
+	user.ID = userID
+	user.Email = email
+	user.Password = password
+	user.IsChirpyRed = ischirpyred
+
 	db.users[userID] = user
 
+	if err := db.appendJournal(journalEntry{Op: opPutUser, User: &user}); err != nil {
+		return User{}, err
+	}
+
 	return user, nil
 }
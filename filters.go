@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const filterReloadInterval = 5 * time.Second
+
+type filterAction string
+
+const (
+	filterActionReplace filterAction = "replace"
+	filterActionReject  filterAction = "reject"
+	filterActionFlag    filterAction = "flag"
+)
+
+type filterResult struct {
+	Body     string
+	Rejected bool
+	Flags    []string
+}
+
+type chirpFilter interface {
+	Filter(body string) filterResult
+}
+
+type filterChain []chirpFilter
+
+// Run passes the body through each filter in turn, stopping at the first
+// one that rejects it.
+func (c filterChain) Run(body string) filterResult {
+	result := filterResult{Body: body}
+
+	for _, filter := range c {
+		next := filter.Filter(result.Body)
+		result.Body = next.Body
+		result.Flags = append(result.Flags, next.Flags...)
+		if next.Rejected {
+			result.Rejected = true
+			break
+		}
+	}
+
+	return result
+}
+
+type wordFilterConfig struct {
+	Action      filterAction `json:"action"`
+	Replacement string       `json:"replacement"`
+	Words       []string     `json:"words"`
+}
+
+var defaultWordFilterConfig = wordFilterConfig{
+	Action:      filterActionReplace,
+	Replacement: "****",
+	Words:       []string{"kerfuffle", "sharbert", "fornax"},
+}
+
+type wordList struct {
+	action      filterAction
+	replacement string
+	words       map[string]bool
+}
+
+// wordFilter matches chirp words against a list loaded from a JSON config
+// file. The file is re-read whenever it changes, so the list and action can
+// be edited without restarting the server.
+type wordFilter struct {
+	path    string
+	list    atomic.Pointer[wordList]
+	modTime time.Time
+}
+
+func newWordFilter(path string) (*wordFilter, error) {
+	f := &wordFilter{path: path}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *wordFilter) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if f.list.Load() == nil || !f.modTime.IsZero() {
+			f.modTime = time.Time{}
+			f.list.Store(compileWordList(defaultWordFilterConfig))
+			return true, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if f.list.Load() != nil && info.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+
+	// Remember the version even if it turns out to be invalid, so a bad edit
+	// is reported once rather than on every poll.
+	f.modTime = info.ModTime()
+
+	config := wordFilterConfig{
+		Action:      defaultWordFilterConfig.Action,
+		Replacement: defaultWordFilterConfig.Replacement,
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return false, fmt.Errorf("parsing %s: %w", f.path, err)
+	}
+
+	switch config.Action {
+	case filterActionReplace, filterActionReject, filterActionFlag:
+	default:
+		return false, fmt.Errorf("parsing %s: unknown action %q", f.path, config.Action)
+	}
+
+	f.list.Store(compileWordList(config))
+
+	return true, nil
+}
+
+func compileWordList(config wordFilterConfig) *wordList {
+	list := &wordList{
+		action:      config.Action,
+		replacement: config.Replacement,
+		words:       make(map[string]bool, len(config.Words)),
+	}
+
+	for _, word := range config.Words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			list.words[word] = true
+		}
+	}
+
+	return list
+}
+
+func (f *wordFilter) Filter(body string) filterResult {
+	list := f.list.Load()
+	result := filterResult{Body: body}
+
+	var matched []string
+	var cleaned strings.Builder
+
+	last := 0
+	for _, span := range wordSpans(body) {
+		word := strings.ToLower(body[span[0]:span[1]])
+		if !list.words[word] {
+			continue
+		}
+		matched = append(matched, word)
+
+		cleaned.WriteString(body[last:span[0]])
+		cleaned.WriteString(list.replacement)
+		last = span[1]
+	}
+
+	if len(matched) == 0 {
+		return result
+	}
+
+	switch list.action {
+	case filterActionReject:
+		result.Rejected = true
+	case filterActionFlag:
+		result.Flags = []string{"Matched filtered words: " + strings.Join(matched, ", ")}
+	default:
+		cleaned.WriteString(body[last:])
+		result.Body = cleaned.String()
+	}
+
+	return result
+}
+
+// wordSpans returns the byte offsets of each run of letters, digits and
+// combining marks in s. Everything else, including punctuation and any kind
+// of whitespace, separates words.
+func wordSpans(s string) [][2]int {
+	var spans [][2]int
+
+	start := -1
+	for i, r := range s {
+		inWord := unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+
+	return spans
+}
+
+func flagForReview(db database.Store, chirpID int, flags []string) {
+	for _, reason := range flags {
+		if _, err := db.CreateReport(database.Report{ChirpID: chirpID, Reason: reason}); err != nil {
+			log.Printf("Error flagging chirp %d for review: %v", chirpID, err)
+		}
+	}
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 
 	"github.com/go-chi/chi/v5"
@@ -13,205 +13,384 @@ import (
 
 var chirpsMutex sync.RWMutex
 
+type chirpTooLongResponse struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	Length int    `json:"length"`
+	Limit  int    `json:"limit"`
+}
+
+func respondWithChirpTooLong(w http.ResponseWriter, err *database.ChirpTooLongError) {
+	respondWithJSON(w, http.StatusBadRequest, chirpTooLongResponse{
+		Error:  "Chirp is too long",
+		Code:   "chirp_too_long",
+		Length: err.Length,
+		Limit:  err.Limit,
+	})
+}
+
 func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
-	tokenString := extractJWTTokenFromHeader(r)
-	if tokenString == "" {
+	principal, ok := principalFrom(ctx)
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
 		return
 	}
 
-	token, err := parseAndValidateJWTToken(cfg, tokenString)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+	var params struct {
+		Body          string   `json:"body"`
+		InReplyTo     *int     `json:"in_reply_to"`
+		QuotedChirpID *int     `json:"quoted_chirp_id"`
+		MediaIDs      []string `json:"media_ids"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	authorID, err := token.Claims.GetSubject()
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unable to find User ID")
+	if len(params.MediaIDs) > maxChirpMedia {
+		respondWithError(w, http.StatusBadRequest, "Too many media attachments")
+		return
 	}
 
-	var params struct {
-		Body string `json:"body"`
+	// A hidden chirp can't be replied to or quoted by anyone who can't see
+	// it, and the answer doesn't reveal that it exists.
+	for _, referencedID := range []*int{params.InReplyTo, params.QuotedChirpID} {
+		if referencedID == nil {
+			continue
+		}
+
+		referenced, err := db.GetChirp(*referencedID)
+		if errors.Is(err, database.ErrNotFound) || err == nil && !cfg.canViewChirp(r, referenced) {
+			respondWithError(w, http.StatusBadRequest, "Referenced chirp does not exist")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+			return
+		}
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&params); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+	filtered := cfg.chirpFilters.Run(params.Body)
+	if filtered.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains disallowed words")
 		return
 	}
+	params.Body = filtered.Body
 
-	params.Body = remove_profanity(params.Body)
+	mentions, emailMentions, err := resolveMentions(db, params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve mentions")
+		return
+	}
 
-	chirp, err := db.CreateChirp(params.Body, authorID)
+	chirp, err := db.CreateChirp(params.Body, strconv.Itoa(principal.UserID), database.ChirpOptions{
+		InReplyTo:     params.InReplyTo,
+		QuotedChirpID: params.QuotedChirpID,
+		Hashtags:      extractHashtags(params.Body),
+		Mentions:      mentions,
+		MediaIDs:      params.MediaIDs,
+	})
+	if errors.Is(err, database.ErrReferencedChirpNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Referenced chirp does not exist")
+		return
+	}
+	if errors.Is(err, database.ErrReferencedMediaNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Referenced media does not exist")
+		return
+	}
+	var tooLong *database.ChirpTooLongError
+	if errors.As(err, &tooLong) {
+		respondWithChirpTooLong(w, tooLong)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, chirp)
+	flagForReview(db, chirp.ID, filtered.Flags)
+
+	notifyMentions(db, chirp, append(mentions, emailMentions...), nil)
+
+	if chirp.InReplyTo != nil {
+		if parent, err := db.GetChirp(*chirp.InReplyTo); err == nil {
+			notify(db, database.Notification{
+				UserID:  parent.AuthorID,
+				Type:    database.NotificationReply,
+				ActorID: chirp.AuthorID,
+				ChirpID: &chirp.ID,
+			})
+		}
+	}
+
+	respondWithJSON(w, http.StatusCreated, cfg.viewableChirp(r, chirp))
 }
 
-func listChirpsHandler(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) listChirpsHandler(w http.ResponseWriter, r *http.Request) {
 	chirpsMutex.Lock()
 	defer chirpsMutex.Unlock()
 
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
 	chirps, err := db.GetChirps()
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Unable to find chirps")
 		return
 	}
+	chirps = cfg.visibleChirps(r, chirps)
 
-	sort := r.URL.Query().Get("sort")
 	id := r.URL.Query().Get("author_id")
 
-	var response []database.Chirp
+	order, err := parseChirpSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if sort != "desc" {
-		sort = "asc"
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if id == "" {
-		if sort == "asc" {
-			respondWithJSON(w, http.StatusOK, chirps)
+	if id != "" {
+		authorID, err := strconv.Atoi(id)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Failed to convert author ID into int")
 			return
-		} else if sort == "desc" {
-			for i := len(chirps) - 1; i >= 0; i-- {
-				response = append(response, chirps[i])
-			}
+		}
 
-			respondWithJSON(w, http.StatusOK, response)
-			return
+		filtered := []database.Chirp{}
+		for _, chirp := range chirps {
+			if chirp.AuthorID == authorID {
+				filtered = append(filtered, chirp)
+			}
 		}
+		chirps = filtered
 	}
 
-	authorID, err := strconv.Atoi(id)
+	sortChirps(chirps, order)
+
+	if err := cfg.markLikedByViewer(r, db, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	if !page.paged {
+		respondWithJSON(w, http.StatusOK, chirps)
+		return
+	}
+
+	response, nextCursor, err := paginateChirps(chirps, page, order)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to convert author ID into int")
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if sort == "asc" {
-		for _, chirp := range chirps {
-			if chirp.AuthorID == authorID {
-				response = append(response, chirp)
-			}
-		}
-	} else if sort == "desc" {
-		for i := len(chirps) - 1; i >= 0; i-- {
-			if chirps[i].AuthorID == authorID {
-				response = append(response, chirps[i])
-			}
-		}
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	respondWithJSON(w, http.StatusOK, chirpPage{
+		Chirps:     response,
+		NextCursor: nextCursor,
+	})
 }
 
-func getChirpByID(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) getChirpByID(w http.ResponseWriter, r *http.Request) {
 	chirpString := chi.URLParam(r, "chirpID")
 
 	chirpID, err := strconv.Atoi(chirpString)
 	if err != nil {
-		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
-	chirps, err := db.GetChirps()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) || err == nil && !cfg.canViewChirp(r, chirp) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
 		return
 	}
 
-	if chirpID <= 0 || chirpID > len(chirps) {
-		respondWithError(w, http.StatusNotFound, "Chirp not found")
-	} else {
-		respondWithJSON(w, http.StatusOK, chirps[chirpID-1])
+	chirps := []database.Chirp{chirp}
+	if err := cfg.markLikedByViewer(r, db, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
 	}
+
+	respondWithJSON(w, http.StatusOK, cfg.viewableChirp(r, chirps[0]))
 }
 
 func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
-	chirpString := chi.URLParam(r, "chirpID")
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	authorID := principal.UserID
 
-	chirpID, err := strconv.Atoi(chirpString)
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
-	chirps, err := db.GetChirps()
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unable to find chirps")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
 		return
 	}
 
-	tokenString := extractJWTTokenFromHeader(r)
-	if tokenString == "" {
-		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+	if chirp.AuthorID != authorID {
+		respondWithError(w, http.StatusForbidden, "Can't delete chirp from different account")
 		return
 	}
 
-	token, err := parseAndValidateJWTToken(cfg, tokenString)
+	err = db.DeleteChirp(chirp.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+		respondWithError(w, http.StatusInternalServerError, "Unable to delete chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) updateChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
 		return
 	}
+	authorID := principal.UserID
 
-	authorIDString, err := token.Claims.GetSubject()
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unable to find Author ID")
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	var params struct {
+		Body string `json:"body"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	authorID, err := strconv.Atoi(authorIDString)
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
 		return
 	}
 
-	if chirpID != authorID {
-		respondWithError(w, http.StatusForbidden, "Can't delete chirp from different account")
+	if chirp.AuthorID != authorID {
+		respondWithError(w, http.StatusForbidden, "Can't edit chirp from different account")
 		return
 	}
 
-	err = db.DeleteChirp(chirps[chirpID-1])
+	if chirp.RechirpOfID != nil {
+		respondWithError(w, http.StatusBadRequest, "Can't edit a rechirp")
+		return
+	}
+
+	filtered := cfg.chirpFilters.Run(params.Body)
+	if filtered.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains disallowed words")
+		return
+	}
+	params.Body = filtered.Body
+
+	mentions, emailMentions, err := resolveMentions(db, params.Body)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Unable to delete chirp")
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve mentions")
 		return
 	}
-}
 
-func remove_profanity(original_body string) string {
-	profane_words := map[string]bool{
-		"kerfuffle": true,
-		"sharbert":  true,
-		"fornax":    true,
+	// Email mentions aren't stored, so the old body is resolved again to
+	// avoid notifying those users a second time.
+	_, previousEmailMentions, err := resolveMentions(db, chirp.Body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve mentions")
+		return
+	}
+	previousMentions := append(append([]int{}, chirp.Mentions...), previousEmailMentions...)
+	chirp, err = db.UpdateChirp(chirp.ID, params.Body, extractHashtags(params.Body), mentions)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	var tooLong *database.ChirpTooLongError
+	if errors.As(err, &tooLong) {
+		respondWithChirpTooLong(w, tooLong)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp")
+		return
 	}
 
-	words := strings.Split(original_body, " ")
-	cleanWords := make([]string, len(words))
+	flagForReview(db, chirp.ID, filtered.Flags)
+	notifyMentions(db, chirp, append(mentions, emailMentions...), previousMentions)
 
-	for idx, word := range words {
-		lc_word := strings.ToLower(word)
+	respondWithJSON(w, http.StatusOK, cfg.viewableChirp(r, chirp))
+}
 
-		if profane_words[lc_word] {
-			cleanWords[idx] = "****"
-		} else {
-			cleanWords[idx] = word
-		}
+func (cfg *apiConfig) listChirpRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	if _, ok := cfg.lookupVisibleChirp(w, r, db, chirpID); !ok {
+		return
+	}
+
+	revisions, err := db.GetChirpRevisions(chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch revisions")
+		return
 	}
 
-	return strings.Join(cleanWords, " ")
+	respondWithJSON(w, http.StatusOK, revisions)
 }
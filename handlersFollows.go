@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+type followedUser struct {
+	ID         int       `json:"id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	followerID := principal.UserID
+
+	followeeID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if followerID == followeeID {
+		respondWithError(w, http.StatusBadRequest, "Can't follow yourself")
+		return
+	}
+
+	err = db.Follow(followerID, followeeID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if errors.Is(err, database.ErrDuplicate) {
+		respondWithError(w, http.StatusConflict, "Already following user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to follow user")
+		return
+	}
+
+	notify(db, database.Notification{
+		UserID:  followeeID,
+		Type:    database.NotificationFollow,
+		ActorID: followerID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	followerID := principal.UserID
+
+	followeeID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = db.Unfollow(followerID, followeeID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Not following user")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, func(db database.Store, userID int) ([]database.Follow, error) {
+		return db.GetFollowers(userID)
+	}, func(follow database.Follow) int {
+		return follow.FollowerID
+	})
+}
+
+func listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	listFollows(w, r, func(db database.Store, userID int) ([]database.Follow, error) {
+		return db.GetFollowing(userID)
+	}, func(follow database.Follow) int {
+		return follow.FolloweeID
+	})
+}
+
+func listFollows(w http.ResponseWriter, r *http.Request, fetch func(database.Store, int) ([]database.Follow, error), other func(database.Follow) int) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	follows, err := fetch(db, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch follows")
+		return
+	}
+
+	response := make([]followedUser, 0, len(follows))
+	for _, follow := range follows {
+		response = append(response, followedUser{
+			ID:         other(follow),
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	following, err := db.GetFollowing(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch follows")
+		return
+	}
+
+	authorIDs := make([]int, 0, len(following))
+	for _, follow := range following {
+		authorIDs = append(authorIDs, follow.FolloweeID)
+	}
+
+	chirps, err := db.GetChirpsByAuthors(authorIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		return
+	}
+	chirps = cfg.visibleChirps(r, chirps)
+
+	order := chirpSort{field: "created_at", desc: true}
+	sortChirps(chirps, order)
+
+	response, nextCursor, err := paginateChirps(chirps, page, order)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := cfg.markLikedByViewer(r, db, response); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpPage{
+		Chirps:     response,
+		NextCursor: nextCursor,
+	})
+}
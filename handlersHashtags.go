@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+	maxTrendingLimit      = 50
+)
+
+func (cfg *apiConfig) listHashtagChirpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	tag := normalizeHashtag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	sortParam := r.URL.Query().Get("sort")
+	if sortParam == "" {
+		sortParam = "created_at:desc"
+	}
+
+	order, err := parseChirpSort(sortParam)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirps, err := db.GetChirpsByHashtag(tag)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		return
+	}
+	chirps = cfg.visibleChirps(r, chirps)
+
+	sortChirps(chirps, order)
+
+	response, nextCursor, err := paginateChirps(chirps, page, order)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := cfg.markLikedByViewer(r, db, response); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpPage{
+		Chirps:     response,
+		NextCursor: nextCursor,
+	})
+}
+
+func trendingHashtagsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	window := defaultTrendingWindow
+	if param := r.URL.Query().Get("window"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid window")
+			return
+		}
+		if d > maxTrendingWindow {
+			d = maxTrendingWindow
+		}
+		window = d
+	}
+
+	limit := defaultTrendingLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		if n > maxTrendingLimit {
+			n = maxTrendingLimit
+		}
+		limit = n
+	}
+
+	trending, err := db.GetTrendingHashtags(time.Now().UTC().Add(-window), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch trending hashtags")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, trending)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	if _, ok := cfg.lookupVisibleChirp(w, r, db, chirpID); !ok {
+		return
+	}
+
+	err = db.LikeChirp(chirpID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if errors.Is(err, database.ErrDuplicate) {
+		respondWithError(w, http.StatusConflict, "Chirp already liked")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to like chirp")
+		return
+	}
+
+	chirp, err := db.GetChirp(chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+		return
+	}
+
+	notify(db, database.Notification{
+		UserID:  chirp.AuthorID,
+		Type:    database.NotificationLike,
+		ActorID: userID,
+		ChirpID: &chirp.ID,
+	})
+
+	likedByMe := true
+	chirp.LikedByMe = &likedByMe
+
+	respondWithJSON(w, http.StatusCreated, cfg.viewableChirp(r, chirp))
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	err = db.UnlikeChirp(chirpID, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Like not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to unlike chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) markLikedByViewer(r *http.Request, db database.Store, chirps []database.Chirp) error {
+	principal, ok := principalFrom(r.Context())
+	if !ok {
+		return nil
+	}
+
+	liked, err := db.GetLikedChirpIDs(principal.UserID)
+	if err != nil {
+		return err
+	}
+
+	for i := range chirps {
+		likedByMe := liked[chirps[i].ID]
+		chirps[i].LikedByMe = &likedByMe
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const (
+	maxMediaSize      = 5 << 20
+	maxMediaDimension = 4096
+	maxChirpMedia     = 4
+	mediaURLPrefix    = "/api/media/"
+)
+
+var allowedMediaTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+type mediaResponse struct {
+	database.Media
+	URL string `json:"url"`
+}
+
+func mediaURL(id string) string {
+	return mediaURLPrefix + id
+}
+
+func (cfg *apiConfig) mediaPath(id string) string {
+	return filepath.Join(cfg.mediaDir, id[:2], id)
+}
+
+func (cfg *apiConfig) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	// Leave some headroom for the multipart framing around the file itself.
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+64<<10)
+
+	file, _, err := r.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMediaSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	if len(data) > maxMediaSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedMediaTypes[contentType] {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Unsupported media type")
+		return
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != contentType {
+		respondWithError(w, http.StatusBadRequest, "Invalid image")
+		return
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxMediaDimension || config.Height > maxMediaDimension {
+		respondWithError(w, http.StatusBadRequest, "Image dimensions are out of range")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:])
+
+	if err := cfg.storeMediaFile(id, data); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store media")
+		return
+	}
+
+	media, err := db.CreateMedia(database.Media{
+		ID:          id,
+		OwnerID:     userID,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       config.Width,
+		Height:      config.Height,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store media")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, mediaResponse{
+		Media: media,
+		URL:   mediaURL(media.ID),
+	})
+}
+
+func (cfg *apiConfig) storeMediaFile(id string, data []byte) error {
+	path := cfg.mediaPath(id)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (cfg *apiConfig) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	id := strings.ToLower(chi.URLParam(r, "mediaID"))
+
+	media, err := db.GetMedia(id)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch media")
+		return
+	}
+
+	file, err := os.Open(cfg.mediaPath(media.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to read media")
+		return
+	}
+	defer file.Close()
+
+	// Media is content-addressed, so a given URL never changes.
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+media.ID+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, "", media.CreatedAt, file)
+}
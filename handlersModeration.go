@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const maxReportReasonLength = 500
+
+type reportedChirp struct {
+	Chirp   database.Chirp    `json:"chirp"`
+	Reports []database.Report `json:"reports"`
+}
+
+type reportQueuePage struct {
+	Items      []reportedChirp `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+type moderationLogPage struct {
+	Actions    []database.ModerationAction `json:"actions"`
+	NextCursor string                      `json:"next_cursor,omitempty"`
+}
+
+func (cfg *apiConfig) reportChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	var params struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		respondWithError(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) || err == nil && !cfg.chirpVisibleTo(userID, true, chirp) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+		return
+	}
+
+	report, err := db.CreateReport(database.Report{
+		ChirpID:    chirp.ID,
+		ReporterID: &userID,
+		Reason:     reason,
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if errors.Is(err, database.ErrDuplicate) {
+		respondWithError(w, http.StatusConflict, "Chirp already reported")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to report chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, report)
+}
+
+func listReportQueueHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reports, err := db.GetOpenReports()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch reports")
+		return
+	}
+
+	// Reports come back oldest first, so chirps are queued in the order
+	// they were first reported.
+	queue := []reportedChirp{}
+	positions := make(map[int]int)
+	for _, report := range reports {
+		position, ok := positions[report.ChirpID]
+		if !ok {
+			chirp, err := db.GetChirp(report.ChirpID)
+			if errors.Is(err, database.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+				return
+			}
+
+			position = len(queue)
+			positions[report.ChirpID] = position
+			queue = append(queue, reportedChirp{Chirp: chirp})
+		}
+
+		queue[position].Reports = append(queue[position].Reports, report)
+	}
+
+	response, nextCursor, err := paginateByOffset(queue, page, "reports")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, reportQueuePage{
+		Items:      response,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) hideChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, true)
+}
+
+func (cfg *apiConfig) restoreChirpHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, false)
+}
+
+func (cfg *apiConfig) setChirpHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	adminID := principal.UserID
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirp, err := db.SetChirpHidden(chirpID, hidden)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update chirp")
+		return
+	}
+
+	if _, err := db.ResolveReports(chirp.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve reports")
+		return
+	}
+
+	action := database.ModerationRestoreChirp
+	if hidden {
+		action = database.ModerationHideChirp
+	}
+	recordModeration(db, database.ModerationAction{
+		AdminID: adminID,
+		Action:  action,
+		ChirpID: &chirp.ID,
+		UserID:  &chirp.AuthorID,
+		Reason:  reason,
+	})
+
+	respondWithJSON(w, http.StatusOK, chirp)
+}
+
+func (cfg *apiConfig) adminDeleteChirpHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	adminID := principal.UserID
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+		return
+	}
+
+	err = db.DeleteChirp(chirp.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp")
+		return
+	}
+
+	recordModeration(db, database.ModerationAction{
+		AdminID: adminID,
+		Action:  database.ModerationDeleteChirp,
+		ChirpID: &chirp.ID,
+		UserID:  &chirp.AuthorID,
+		Reason:  reason,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserSuspended(w, r, true)
+}
+
+func (cfg *apiConfig) unsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserSuspended(w, r, false)
+}
+
+func (cfg *apiConfig) setUserSuspended(w http.ResponseWriter, r *http.Request, suspended bool) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	adminID := principal.UserID
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if suspended && cfg.isAdmin(userID) {
+		respondWithError(w, http.StatusBadRequest, "Can't suspend an admin")
+		return
+	}
+
+	reason, err := decodeModerationReason(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := db.SetUserSuspended(userID, suspended)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+
+	action := database.ModerationUnsuspendUser
+	if suspended {
+		action = database.ModerationSuspendUser
+	}
+	recordModeration(db, database.ModerationAction{
+		AdminID: adminID,
+		Action:  action,
+		UserID:  &user.ID,
+		Reason:  reason,
+	})
+
+	respondWithJSON(w, http.StatusOK, user.Response())
+}
+
+func listModerationLogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	actions, err := db.GetModerationActions()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch moderation log")
+		return
+	}
+
+	response, nextCursor, err := paginateByIDDesc(actions, page, "moderation", func(a database.ModerationAction) int {
+		return a.ID
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, moderationLogPage{
+		Actions:    response,
+		NextCursor: nextCursor,
+	})
+}
+
+// decodeModerationReason reads the optional {"reason": "..."} body that
+// admin actions accept.
+func decodeModerationReason(r *http.Request) (string, error) {
+	var params struct {
+		Reason string `json:"reason"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		return "", errors.New("Invalid JSON")
+	}
+
+	reason := strings.TrimSpace(params.Reason)
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		return "", errors.New("Reason is too long")
+	}
+
+	return reason, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+type notificationPage struct {
+	Notifications []database.Notification `json:"notifications"`
+	UnreadCount   int                     `json:"unread_count"`
+	NextCursor    string                  `json:"next_cursor,omitempty"`
+}
+
+func notify(db database.Store, notification database.Notification) {
+	if notification.UserID == notification.ActorID {
+		return
+	}
+
+	if _, err := db.CreateNotification(notification); err != nil {
+		log.Printf("Error creating %s notification: %v", notification.Type, err)
+	}
+}
+
+func (cfg *apiConfig) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	notifications, err := db.GetNotifications(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	unreadCount := 0
+	filtered := []database.Notification{}
+	for _, notification := range notifications {
+		if notification.ReadAt == nil {
+			unreadCount++
+		} else if unreadOnly {
+			continue
+		}
+		filtered = append(filtered, notification)
+	}
+
+	response, nextCursor, err := paginateByIDDesc(filtered, page, "notifications", func(n database.Notification) int {
+		return n.ID
+	})
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, notificationPage{
+		Notifications: response,
+		UnreadCount:   unreadCount,
+		NextCursor:    nextCursor,
+	})
+}
+
+func (cfg *apiConfig) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	principal, ok := principalFrom(ctx)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return
+	}
+	userID := principal.UserID
+
+	var params struct {
+		IDs []int `json:"ids"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	marked, err := db.MarkNotificationsRead(userID, params.IDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark notifications as read")
+		return
+	}
+
+	response := map[string]interface{}{
+		"marked_read": marked,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
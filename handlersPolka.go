@@ -8,7 +8,7 @@ import (
 )
 
 func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request) {
-	tokenString := extractJWTTokenFromHeader(r)
+	tokenString := authorizationCredentials(r, authSchemeAPIKey)
 	if tokenString == "" {
 		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
 		return
@@ -20,7 +20,7 @@ func (cfg *apiConfig) polkaWebhookHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 	users, _ := db.GetUsers()
 
 	var params struct {
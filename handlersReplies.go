@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+type chirpThread struct {
+	Ancestors []database.Chirp `json:"ancestors"`
+	Chirp     database.Chirp   `json:"chirp"`
+	Replies   []database.Chirp `json:"replies"`
+}
+
+func (cfg *apiConfig) listRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	order, err := parseChirpSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, ok := cfg.lookupVisibleChirp(w, r, db, chirpID); !ok {
+		return
+	}
+
+	replies, err := db.GetReplies(chirpID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch replies")
+		return
+	}
+	replies = cfg.visibleChirps(r, replies)
+
+	sortChirps(replies, order)
+
+	if err := cfg.markLikedByViewer(r, db, replies); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	response, nextCursor, err := paginateChirps(replies, page, order)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpPage{
+		Chirps:     response,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) getThreadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	chirpID, err := strconv.Atoi(chi.URLParam(r, "chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) || err == nil && !cfg.canViewChirp(r, chirp) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+		return
+	}
+
+	ancestors := []database.Chirp{}
+	for parentID := chirp.InReplyTo; parentID != nil; {
+		parent, err := db.GetChirp(*parentID)
+		if errors.Is(err, database.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch thread")
+			return
+		}
+
+		ancestors = append([]database.Chirp{parent}, ancestors...)
+		parentID = parent.InReplyTo
+	}
+
+	replies, err := db.GetReplies(chirp.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch replies")
+		return
+	}
+
+	ancestors = cfg.visibleChirps(r, ancestors)
+	replies = cfg.visibleChirps(r, replies)
+
+	self := []database.Chirp{chirp}
+	for _, chirps := range [][]database.Chirp{ancestors, self, replies} {
+		if err := cfg.markLikedByViewer(r, db, chirps); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpThread{
+		Ancestors: ancestors,
+		Chirp:     cfg.viewableChirp(r, self[0]),
+		Replies:   replies,
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+func (cfg *apiConfig) searchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	query, err := parseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chirps, err := db.SearchChirps(query)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+	chirps = cfg.visibleChirps(r, chirps)
+
+	response, nextCursor, err := paginateByOffset(chirps, page, "search")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := cfg.markLikedByViewer(r, db, response); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	if nextCursor != "" {
+		setNextLink(w, r, nextCursor)
+	}
+
+	respondWithJSON(w, http.StatusOK, chirpPage{
+		Chirps:     response,
+		NextCursor: nextCursor,
+	})
+}
@@ -2,22 +2,36 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-	"time"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-chi/chi/v5"
 	"github.com/tmbrody/chirpyGo/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
+type userProfile struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Avatar      string `json:"avatar"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+
+	FollowerCount  int `json:"follower_count"`
+	FollowingCount int `json:"following_count"`
+	ChirpCount     int `json:"chirp_count"`
+}
+
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
 	var params struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Username string `json:"username"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -26,7 +40,19 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := db.CreateUser(params.Email, params.Password)
+	username := database.NormalizeUsername(params.Username)
+	if username != "" {
+		if err := validateUsername(username); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	user, err := db.CreateUser(params.Email, params.Password, username)
+	if errors.Is(err, database.ErrDuplicate) {
+		respondWithError(w, http.StatusConflict, "Username already taken")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -37,12 +63,15 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 
 func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
-	users, _ := db.GetUsers()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
 	var params struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email       string  `json:"email"`
+		Password    string  `json:"password"`
+		Username    *string `json:"username"`
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		Avatar      *string `json:"avatar"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -51,47 +80,147 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokenString := extractJWTTokenFromHeader(r)
-	if tokenString == "" {
+	principal, ok := principalFrom(ctx)
+	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
 		return
 	}
+	userID := principal.UserID
 
-	token, err := parseAndValidateJWTToken(cfg, tokenString)
+	updatedUser, err := db.GetUser(userID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
 		return
 	}
 
-	issuer, _ := token.Claims.GetIssuer()
-	if issuer == "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Using JWT refresh token")
-		return
+	profile := database.Profile{
+		Username:    updatedUser.Username,
+		DisplayName: updatedUser.DisplayName,
+		Bio:         updatedUser.Bio,
+		Avatar:      updatedUser.Avatar,
 	}
+	profileChanged := false
 
-	userID, ok := token.Claims.(jwt.MapClaims)["sub"].(int)
-	if !ok {
-		respondWithError(w, http.StatusUnauthorized, "Failed to extract user ID from JWT claims")
+	if params.Username != nil {
+		profile.Username = database.NormalizeUsername(*params.Username)
+		profileChanged = true
+	}
+	if params.DisplayName != nil {
+		profile.DisplayName = strings.TrimSpace(*params.DisplayName)
+		profileChanged = true
+	}
+	if params.Bio != nil {
+		profile.Bio = strings.TrimSpace(*params.Bio)
+		profileChanged = true
+	}
+	if params.Avatar != nil {
+		profile.Avatar = strings.TrimSpace(*params.Avatar)
+		profileChanged = true
+
+		if media, err := db.GetMedia(strings.TrimPrefix(profile.Avatar, mediaURLPrefix)); err == nil {
+			profile.Avatar = mediaURL(media.ID)
+		} else if strings.HasPrefix(profile.Avatar, mediaURLPrefix) {
+			respondWithError(w, http.StatusBadRequest, "Referenced media does not exist")
+			return
+		}
+	}
+
+	if profileChanged {
+		if err := validateProfile(profile); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		updatedUser, err = db.UpdateProfile(userID, profile)
+		if errors.Is(err, database.ErrDuplicate) {
+			respondWithError(w, http.StatusConflict, "Username already taken")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user data")
+			return
+		}
+	}
+
+	if params.Email != "" || params.Password != "" {
+		email := params.Email
+		if email == "" {
+			email = updatedUser.Email
+		}
+
+		password, passwordHashed := params.Password, false
+		if password == "" {
+			password, passwordHashed = updatedUser.Password, true
+		}
+
+		updatedUser, err = db.UpdateUser(userID, email, password, updatedUser.IsChirpyRed, passwordHashed)
+		if errors.Is(err, database.ErrDuplicate) {
+			respondWithError(w, http.StatusConflict, "Email already in use")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to update user data")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, updatedUser.Response())
+}
+
+func (cfg *apiConfig) getUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db, _ := ctx.Value(dbContextKey).(database.Store)
+
+	user, err := db.GetUserByUsername(database.NormalizeUsername(chi.URLParam(r, "username")))
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch user")
 		return
 	}
 
-	updatedUser, err := db.UpdateUser(userID, params.Email, params.Password, users[userID].IsChirpyRed, false)
+	followers, err := db.GetFollowers(user.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to update user data")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch followers")
 		return
 	}
 
-	response := map[string]interface{}{
-		"id":    updatedUser.ID,
-		"email": updatedUser.Email,
+	following, err := db.GetFollowing(user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch following")
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	chirps, err := db.GetChirpsByAuthors([]int{user.ID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		return
+	}
+	chirps = cfg.visibleChirps(r, chirps)
+
+	respondWithJSON(w, http.StatusOK, userProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Avatar:      user.Avatar,
+		IsChirpyRed: user.IsChirpyRed,
+
+		FollowerCount:  len(followers),
+		FollowingCount: len(following),
+		ChirpCount:     len(chirps),
+	})
 }
 
 func (cfg *apiConfig) loginUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 	users, err := db.GetUsers()
 
 	var params struct {
@@ -117,47 +246,41 @@ func (cfg *apiConfig) loginUserHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			accessClaims := jwt.RegisteredClaims{
-				Issuer:   "chirpy-access",
-				Subject:  strconv.Itoa(user.ID),
-				IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			if user.SuspendedAt != nil {
+				respondWithError(w, http.StatusForbidden, "Account suspended")
+				return
 			}
 
-			refreshClaims := jwt.RegisteredClaims{
-				Issuer:   "chirpy-refresh",
-				Subject:  strconv.Itoa(user.ID),
-				IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+			signedToken, err := cfg.signAccessToken(user.ID)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+				return
 			}
 
-			accessExpiration := time.Hour
-			accessClaims.ExpiresAt = jwt.NewNumericDate(time.Now().UTC().Add(accessExpiration))
-
-			refreshExpiration := 60 * (24 * time.Hour)
-			refreshClaims.ExpiresAt = jwt.NewNumericDate(time.Now().UTC().Add(refreshExpiration))
-
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-			refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-
-			signedToken, err := token.SignedString([]byte(cfg.jwtSecret))
+			refreshToken, err := newRefreshToken(user.ID)
 			if err != nil {
 				respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 				return
 			}
 
-			signedRefreshToken, err := refreshToken.SignedString([]byte(cfg.jwtSecret))
+			if err := db.CreateRefreshToken(refreshToken); err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to store refresh token")
+				return
+			}
+
+			signedRefreshToken, err := cfg.signRefreshToken(refreshToken)
 			if err != nil {
 				respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 				return
 			}
 
-			userID, _ := strconv.Atoi(accessClaims.Subject)
-
 			response := map[string]interface{}{
-				"id":            userID,
+				"id":            user.ID,
 				"email":         user.Email,
 				"token":         signedToken,
 				"refresh_token": signedRefreshToken,
 				"is_chirpy_red": user.IsChirpyRed,
+				"username":      user.Username,
 			}
 
 			respondWithJSON(w, http.StatusOK, response)
@@ -0,0 +1,12 @@
+package main
+
+import "net/http"
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{
+		Keys: cfg.keys.publicKeys(),
+	})
+}
@@ -1,99 +1,160 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/tmbrody/chirpyGo/database"
 )
 
-func extractJWTTokenFromHeader(r *http.Request) string {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return ""
-	}
+const refreshTokenLifetime = 60 * (24 * time.Hour)
+
+// newRefreshToken starts a new token family; RotateRefreshToken moves the
+// token into the family of the one it replaces.
+func newRefreshToken(userID int) (database.RefreshToken, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return database.RefreshToken{}, err
+	}
+	id := hex.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	return database.RefreshToken{
+		ID:        id,
+		FamilyID:  id,
+		UserID:    userID,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenLifetime),
+	}, nil
+}
 
-	if len(authHeader) > 7 && (authHeader[:7] == "Bearer " || authHeader[:7] == "ApiKey ") {
-		return authHeader[7:]
-	}
-	return ""
+func (cfg *apiConfig) signRefreshToken(record database.RefreshToken) (string, error) {
+	return cfg.keys.sign(jwt.RegisteredClaims{
+		Issuer:    refreshTokenIssuer,
+		Subject:   strconv.Itoa(record.UserID),
+		Audience:  jwt.ClaimStrings{tokenAudience},
+		ID:        record.ID,
+		IssuedAt:  jwt.NewNumericDate(record.IssuedAt),
+		ExpiresAt: jwt.NewNumericDate(record.ExpiresAt),
+	})
 }
 
-func parseAndValidateJWTToken(cfg *apiConfig, tokenString string) (*jwt.Token, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
+// refreshTokenFromRequest parses the refresh token in the Authorization
+// header, answering the request itself when it is missing or invalid.
+// Refresh tokens minted before the aud claim existed are still accepted.
+func (cfg *apiConfig) refreshTokenFromRequest(w http.ResponseWriter, r *http.Request) (string, *tokenClaims, bool) {
+	tokenString := authorizationCredentials(r, authSchemeBearer)
+	if tokenString == "" {
+		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+		return "", nil, false
+	}
 
-		return []byte(cfg.jwtSecret), nil
-	})
+	claims, err := cfg.parseToken(tokenString, refreshTokenIssuer)
+	if errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		respondWithError(w, http.StatusUnauthorized, "Not using JWT refresh token")
+		return "", nil, false
+	}
 	if err != nil {
-		return nil, err
+		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+		return "", nil, false
 	}
-	return token, nil
+
+	return tokenString, claims, true
 }
 
 func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
-	tokenString := extractJWTTokenFromHeader(r)
-	if tokenString == "" {
-		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+	tokenString, claims, ok := cfg.refreshTokenFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	token, err := parseAndValidateJWTToken(cfg, tokenString)
+	revoked, err := db.IsTokenRevoked(tokenString)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch revoked tokens")
+		return
+	}
+	if revoked {
+		respondWithError(w, http.StatusUnauthorized, "Using revoked JWT refresh token")
 		return
 	}
 
-	issuer, _ := token.Claims.GetIssuer()
-	if issuer != "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Not using JWT refresh token")
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unable to find User ID")
+		return
+	}
+
+	if isSuspended(db, id) {
+		respondWithError(w, http.StatusForbidden, "Account suspended")
 		return
 	}
 
-	revokedTokens, err := db.GetRevokedTokens()
+	next, err := newRefreshToken(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch revoked tokens")
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	for _, revokedToken := range revokedTokens {
-		if tokenString == revokedToken.RevokedTokenID {
+	jti := claims.ID
+	if jti == "" {
+		// Tokens issued before rotation carry no jti. Swap them for a
+		// tracked token once and refuse the old one from then on. The
+		// revoke is the gate: of two concurrent refreshes with the same
+		// token, only the one that inserted it gets a new token.
+		err = cfg.revokeToken(db, tokenString, claims)
+		if errors.Is(err, database.ErrDuplicate) {
 			respondWithError(w, http.StatusUnauthorized, "Using revoked JWT refresh token")
 			return
 		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to rotate refresh token")
+			return
+		}
+		err = db.CreateRefreshToken(next)
+	} else {
+		err = db.RotateRefreshToken(jti, next)
 	}
 
-	userID, err := token.Claims.GetSubject()
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unable to find User ID")
+	switch {
+	case errors.Is(err, database.ErrRefreshTokenReused):
+		log.Printf("refresh token %s reused; revoked its family for user %d", jti, id)
+		respondWithError(w, http.StatusUnauthorized, "Reused JWT refresh token")
+		return
+	case errors.Is(err, database.ErrRefreshTokenRevoked):
+		respondWithError(w, http.StatusUnauthorized, "Using revoked JWT refresh token")
+		return
+	case errors.Is(err, database.ErrNotFound):
+		respondWithError(w, http.StatusUnauthorized, "Unknown JWT refresh token")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "Failed to rotate refresh token")
+		return
 	}
 
-	accessClaims := jwt.RegisteredClaims{
-		Issuer:   "chirpy-access",
-		Subject:  userID,
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+	signedNewToken, err := cfg.signAccessToken(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
 	}
 
-	accessExpiration := time.Hour
-	accessClaims.ExpiresAt = jwt.NewNumericDate(time.Now().UTC().Add(accessExpiration))
-
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-
-	signedNewToken, err := newToken.SignedString([]byte(cfg.jwtSecret))
+	signedRefreshToken, err := cfg.signRefreshToken(next)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
 	response := map[string]interface{}{
-		"token": signedNewToken,
+		"token":         signedNewToken,
+		"refresh_token": signedRefreshToken,
 	}
 
 	respondWithJSON(w, http.StatusOK, response)
@@ -101,29 +162,38 @@ func (cfg *apiConfig) refreshTokenHandler(w http.ResponseWriter, r *http.Request
 
 func (cfg *apiConfig) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	db, _ := ctx.Value(dbContextKey).(*database.DB)
+	db, _ := ctx.Value(dbContextKey).(database.Store)
 
-	tokenString := extractJWTTokenFromHeader(r)
-	if tokenString == "" {
-		respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+	tokenString, claims, ok := cfg.refreshTokenFromRequest(w, r)
+	if !ok {
 		return
 	}
 
-	token, err := parseAndValidateJWTToken(cfg, tokenString)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token")
+	// Tracked tokens are revoked along with their whole family, so every
+	// token descended from the same login stops working. Tokens issued
+	// before rotation have no jti and go on the revoked list instead.
+	if claims.ID == "" {
+		err := cfg.revokeToken(db, tokenString, claims)
+		if err != nil && !errors.Is(err, database.ErrDuplicate) {
+			respondWithError(w, http.StatusInternalServerError, "Failed to revoke refresh token")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, "JWT refresh token successfully revoked")
 		return
 	}
 
-	issuer, _ := token.Claims.GetIssuer()
-	if issuer != "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Not using JWT refresh token")
+	record, err := db.GetRefreshToken(claims.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Unknown JWT refresh token")
 		return
 	}
-
-	err = db.StoreRevokedToken(tokenString)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch refresh token")
+		return
+	}
+
+	if err := db.RevokeRefreshTokenFamily(record.FamilyID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke refresh token")
 		return
 	}
 
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+// refreshStep calls /api/refresh or /api/revoke with the named token and,
+// when save is set, keeps the refresh token it returns under that name.
+type refreshStep struct {
+	endpoint   string
+	token      string
+	wantStatus int
+	save       string
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		suspended bool
+		steps     []refreshStep
+	}{
+		{
+			name: "each refresh replaces the token",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusOK, save: "second"},
+				{endpoint: "refresh", token: "second", wantStatus: http.StatusOK, save: "third"},
+				{endpoint: "refresh", token: "third", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "reuse revokes the family",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusOK, save: "second"},
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusUnauthorized},
+				{endpoint: "refresh", token: "second", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "revoke logs out the family",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusOK, save: "second"},
+				{endpoint: "revoke", token: "second", wantStatus: http.StatusOK},
+				{endpoint: "refresh", token: "second", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "revoking a replaced token still logs out its descendants",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusOK, save: "second"},
+				{endpoint: "revoke", token: "login", wantStatus: http.StatusOK},
+				{endpoint: "refresh", token: "second", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "legacy token is exchanged once",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "legacy", wantStatus: http.StatusOK, save: "tracked"},
+				{endpoint: "refresh", token: "legacy", wantStatus: http.StatusUnauthorized},
+				{endpoint: "refresh", token: "tracked", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "revoked legacy token",
+			steps: []refreshStep{
+				{endpoint: "revoke", token: "legacy", wantStatus: http.StatusOK},
+				{endpoint: "refresh", token: "legacy", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "untracked jti",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "untracked", wantStatus: http.StatusUnauthorized},
+				{endpoint: "revoke", token: "untracked", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "access token",
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "access", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name:      "suspended user",
+			suspended: true,
+			steps: []refreshStep{
+				{endpoint: "refresh", token: "login", wantStatus: http.StatusForbidden},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+			if err != nil {
+				t.Fatalf("NewDB: %v", err)
+			}
+
+			keys, err := newKeyStore("", "secret")
+			if err != nil {
+				t.Fatalf("newKeyStore: %v", err)
+			}
+			cfg := &apiConfig{keys: keys}
+
+			user, err := db.CreateUser("a@example.com", "password", "alice")
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+			if tt.suspended {
+				if _, err := db.SetUserSuspended(user.ID, true); err != nil {
+					t.Fatalf("SetUserSuspended: %v", err)
+				}
+			}
+
+			tokens := map[string]string{}
+
+			login, err := newRefreshToken(user.ID)
+			if err != nil {
+				t.Fatalf("newRefreshToken: %v", err)
+			}
+			if err := db.CreateRefreshToken(login); err != nil {
+				t.Fatalf("CreateRefreshToken: %v", err)
+			}
+			if tokens["login"], err = cfg.signRefreshToken(login); err != nil {
+				t.Fatalf("signRefreshToken: %v", err)
+			}
+
+			untracked, err := newRefreshToken(user.ID)
+			if err != nil {
+				t.Fatalf("newRefreshToken: %v", err)
+			}
+			if tokens["untracked"], err = cfg.signRefreshToken(untracked); err != nil {
+				t.Fatalf("signRefreshToken: %v", err)
+			}
+
+			// Refresh tokens from before rotation had no jti.
+			now := time.Now()
+			if tokens["legacy"], err = keys.sign(jwt.RegisteredClaims{
+				Issuer:    refreshTokenIssuer,
+				Subject:   strconv.Itoa(user.ID),
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(refreshTokenLifetime)),
+			}); err != nil {
+				t.Fatalf("signing legacy token: %v", err)
+			}
+
+			if tokens["access"], err = cfg.signAccessToken(user.ID); err != nil {
+				t.Fatalf("signAccessToken: %v", err)
+			}
+
+			handlers := map[string]http.HandlerFunc{
+				"refresh": withDB(cfg.refreshTokenHandler, db),
+				"revoke":  withDB(cfg.revokeTokenHandler, db),
+			}
+
+			for i, step := range tt.steps {
+				req := httptest.NewRequest(http.MethodPost, "/api/"+step.endpoint, nil)
+				req.Header.Set("Authorization", "Bearer "+tokens[step.token])
+				rec := httptest.NewRecorder()
+				handlers[step.endpoint](rec, req)
+
+				if rec.Code != step.wantStatus {
+					t.Fatalf("step %d: %s with %s = %d %s, want %d",
+						i+1, step.endpoint, step.token, rec.Code, rec.Body.String(), step.wantStatus)
+				}
+
+				if step.save == "" {
+					continue
+				}
+
+				var response struct {
+					RefreshToken string `json:"refresh_token"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("step %d: decoding response: %v", i+1, err)
+				}
+				if response.RefreshToken == "" || response.RefreshToken == tokens[step.token] {
+					t.Fatalf("step %d: refresh did not return a new refresh token", i+1)
+				}
+				tokens[step.save] = response.RefreshToken
+			}
+		})
+	}
+}
+
+func TestLegacyRefreshTokenIsExchangedOnceConcurrently(t *testing.T) {
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	keys, err := newKeyStore("", "secret")
+	if err != nil {
+		t.Fatalf("newKeyStore: %v", err)
+	}
+	cfg := &apiConfig{keys: keys}
+
+	user, err := db.CreateUser("a@example.com", "password", "alice")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	now := time.Now()
+	legacy, err := keys.sign(jwt.RegisteredClaims{
+		Issuer:    refreshTokenIssuer,
+		Subject:   strconv.Itoa(user.ID),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(refreshTokenLifetime)),
+	})
+	if err != nil {
+		t.Fatalf("signing legacy token: %v", err)
+	}
+
+	handler := withDB(cfg.refreshTokenHandler, db)
+
+	const attempts = 20
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+			req.Header.Set("Authorization", "Bearer "+legacy)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			statuses <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	exchanged := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			exchanged++
+		}
+	}
+	if exchanged != 1 {
+		t.Errorf("legacy token was exchanged %d times, want 1", exchanged)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	keysReloadInterval = 5 * time.Second
+
+	// Tokens minted before key IDs existed carry no kid header; they are
+	// checked against the key with this ID.
+	legacyKeyID = "default"
+)
+
+type signingKeyConfig struct {
+	ID             string     `json:"kid"`
+	Algorithm      string     `json:"alg"`
+	Secret         string     `json:"secret"`
+	PrivateKeyFile string     `json:"private_key_file"`
+	PublicKeyFile  string     `json:"public_key_file"`
+	RetiredAt      *time.Time `json:"retired_at,omitempty"`
+}
+
+type keyringConfig struct {
+	Active string             `json:"active"`
+	Keys   []signingKeyConfig `json:"keys"`
+}
+
+// signingKey is one entry in the keyring. For HMAC keys signKey and
+// verifyKey are the same secret; asymmetric keys kept only to verify old
+// tokens may have no signKey.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	retiredAt *time.Time
+}
+
+type keyring struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// keyStore holds the JWT signing keys. They are read from a JSON keys file
+// that is re-read whenever it changes, so operators can add a key, make it
+// active and retire the old one without a restart. Without a keys file, or
+// while it is missing, the JWT_SECRET environment variable is the only key.
+type keyStore struct {
+	path           string
+	fallbackSecret string
+	ring           atomic.Pointer[keyring]
+	modTime        time.Time
+}
+
+func newKeyStore(path string, fallbackSecret string) (*keyStore, error) {
+	k := &keyStore{path: path, fallbackSecret: fallbackSecret}
+	if _, err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (k *keyStore) reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if k.path == "" || errors.Is(err, os.ErrNotExist) {
+		if k.ring.Load() == nil || !k.modTime.IsZero() {
+			ring, err := compileKeyring(keyringConfig{
+				Active: legacyKeyID,
+				Keys:   []signingKeyConfig{{ID: legacyKeyID, Secret: k.fallbackSecret}},
+			}, "")
+			if err != nil {
+				return false, fmt.Errorf("no keys file and JWT_SECRET is unusable: %w", err)
+			}
+			k.modTime = time.Time{}
+			k.ring.Store(ring)
+			return true, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if k.ring.Load() != nil && info.ModTime().Equal(k.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return false, err
+	}
+	k.modTime = info.ModTime()
+
+	var config keyringConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return false, fmt.Errorf("parsing %s: %w", k.path, err)
+	}
+
+	ring, err := compileKeyring(config, filepath.Dir(k.path))
+	if err != nil {
+		return false, fmt.Errorf("parsing %s: %w", k.path, err)
+	}
+	k.ring.Store(ring)
+
+	return true, nil
+}
+
+func compileKeyring(config keyringConfig, baseDir string) (*keyring, error) {
+	ring := &keyring{keys: make(map[string]*signingKey, len(config.Keys))}
+
+	for _, keyConfig := range config.Keys {
+		if keyConfig.ID == "" {
+			return nil, errors.New("key is missing a kid")
+		}
+		if _, ok := ring.keys[keyConfig.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %q", keyConfig.ID)
+		}
+
+		key, err := loadSigningKey(keyConfig, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyConfig.ID, err)
+		}
+		ring.keys[key.id] = key
+	}
+
+	active, ok := ring.keys[config.Active]
+	if !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", config.Active)
+	}
+	if active.retiredAt != nil {
+		return nil, fmt.Errorf("active key %q is retired", config.Active)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active key %q has no private key", config.Active)
+	}
+	ring.active = active
+
+	return ring, nil
+}
+
+func loadSigningKey(config signingKeyConfig, baseDir string) (*signingKey, error) {
+	key := &signingKey{id: config.ID, retiredAt: config.RetiredAt}
+
+	readPEM := func(path string) ([]byte, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		return os.ReadFile(path)
+	}
+
+	switch config.Algorithm {
+	case "", "HS256":
+		if config.Secret == "" {
+			return nil, errors.New("no secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(config.Secret)
+		key.verifyKey = key.signKey
+
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+		if config.PrivateKeyFile != "" {
+			data, err := readPEM(config.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = private.(ed25519.PrivateKey).Public()
+		} else if config.PublicKeyFile != "" {
+			data, err := readPEM(config.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseEdPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		} else {
+			return nil, errors.New("no private_key_file or public_key_file")
+		}
+
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if config.PrivateKeyFile != "" {
+			data, err := readPEM(config.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else if config.PublicKeyFile != "" {
+			data, err := readPEM(config.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = public
+		} else {
+			return nil, errors.New("no private_key_file or public_key_file")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", config.Algorithm)
+	}
+
+	return key, nil
+}
+
+func (k *keyStore) sign(claims jwt.Claims) (string, error) {
+	key := k.ring.Load().active
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.signKey)
+}
+
+// keyFunc picks the verification key for a token from its kid header. A
+// retired key only vouches for tokens issued before it was retired; expiry
+// is still enforced by the parser.
+func (k *keyStore) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid := legacyKeyID
+	if v, ok := token.Header["kid"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid kid header")
+		}
+		kid = s
+	}
+
+	key, ok := k.ring.Load().keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	// The key, not the token, decides the algorithm, so a token can't get
+	// an RSA public key treated as an HMAC secret.
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+
+	if key.retiredAt != nil {
+		issuedAt, err := token.Claims.GetIssuedAt()
+		if err != nil || issuedAt == nil || issuedAt.After(*key.retiredAt) {
+			return nil, fmt.Errorf("signing key %q is retired", kid)
+		}
+	}
+
+	return key.verifyKey, nil
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv,omitempty"`
+	X       string `json:"x,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	KeyID   string `json:"kid"`
+	Alg     string `json:"alg"`
+	Use     string `json:"use"`
+}
+
+// publicKeys returns the asymmetric keys in the keyring, retired ones
+// included, so other services can verify tokens that are still valid.
+// HMAC secrets are never published.
+func (k *keyStore) publicKeys() []jsonWebKey {
+	ring := k.ring.Load()
+
+	ids := make([]string, 0, len(ring.keys))
+	for id := range ring.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := []jsonWebKey{}
+	for _, id := range ids {
+		key := ring.keys[id]
+		switch public := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwks = append(jwks, jsonWebKey{
+				KeyType: "OKP",
+				Curve:   "Ed25519",
+				X:       base64.RawURLEncoding.EncodeToString(public),
+				KeyID:   key.id,
+				Alg:     key.method.Alg(),
+				Use:     "sig",
+			})
+		case *rsa.PublicKey:
+			jwks = append(jwks, jsonWebKey{
+				KeyType: "RSA",
+				N:       base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+				KeyID:   key.id,
+				Alg:     key.method.Alg(),
+				Use:     "sig",
+			})
+		}
+	}
+
+	return jwks
+}
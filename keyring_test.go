@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeEdKeys writes a fresh Ed25519 key pair as PEM files in dir and
+// returns their names and the public key.
+func writeEdKeys(t *testing.T, dir string) (string, string, ed25519.PublicKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("marshalling private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("marshalling public key: %v", err)
+	}
+
+	writePEM := func(name, blockType string, der []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+	writePEM("ed.pem", "PRIVATE KEY", privateDER)
+	writePEM("ed.pub.pem", "PUBLIC KEY", publicDER)
+
+	return "ed.pem", "ed.pub.pem", public
+}
+
+// signTestToken signs claims with key, setting the kid header unless kid
+// is empty.
+func signTestToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	return signed
+}
+
+func TestCompileKeyring(t *testing.T) {
+	dir := t.TempDir()
+	privateFile, publicFile, _ := writeEdKeys(t, dir)
+	retired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		config  keyringConfig
+		wantErr string
+	}{
+		{
+			name: "hmac and eddsa keys",
+			config: keyringConfig{Active: "ed", Keys: []signingKeyConfig{
+				{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: privateFile},
+				{ID: "old", Secret: "old secret", RetiredAt: &retired},
+			}},
+		},
+		{
+			name:    "missing kid",
+			config:  keyringConfig{Active: "a", Keys: []signingKeyConfig{{Secret: "s"}}},
+			wantErr: "missing a kid",
+		},
+		{
+			name: "duplicate kid",
+			config: keyringConfig{Active: "a", Keys: []signingKeyConfig{
+				{ID: "a", Secret: "s"},
+				{ID: "a", Secret: "t"},
+			}},
+			wantErr: "duplicate key",
+		},
+		{
+			name:    "hmac key without a secret",
+			config:  keyringConfig{Active: "a", Keys: []signingKeyConfig{{ID: "a"}}},
+			wantErr: "no secret",
+		},
+		{
+			name:    "unsupported algorithm",
+			config:  keyringConfig{Active: "a", Keys: []signingKeyConfig{{ID: "a", Algorithm: "none"}}},
+			wantErr: "unsupported algorithm",
+		},
+		{
+			name:    "active key not in the keyring",
+			config:  keyringConfig{Active: "b", Keys: []signingKeyConfig{{ID: "a", Secret: "s"}}},
+			wantErr: "not in the keyring",
+		},
+		{
+			name:    "active key is retired",
+			config:  keyringConfig{Active: "a", Keys: []signingKeyConfig{{ID: "a", Secret: "s", RetiredAt: &retired}}},
+			wantErr: "is retired",
+		},
+		{
+			name:    "active key can only verify",
+			config:  keyringConfig{Active: "ed", Keys: []signingKeyConfig{{ID: "ed", Algorithm: "EdDSA", PublicKeyFile: publicFile}}},
+			wantErr: "has no private key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileKeyring(tt.config, dir)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("compileKeyring: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("compileKeyring error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyFunc(t *testing.T) {
+	dir := t.TempDir()
+	privateFile, _, edPublic := writeEdKeys(t, dir)
+
+	now := time.Now()
+	retiredAt := now.Add(-time.Hour)
+
+	ring, err := compileKeyring(keyringConfig{Active: "current", Keys: []signingKeyConfig{
+		{ID: "current", Secret: "current secret"},
+		{ID: "retired", Secret: "retired secret", RetiredAt: &retiredAt},
+		{ID: legacyKeyID, Secret: "legacy secret"},
+		{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: privateFile},
+	}}, dir)
+	if err != nil {
+		t.Fatalf("compileKeyring: %v", err)
+	}
+	keys := &keyStore{}
+	keys.ring.Store(ring)
+
+	claimsIssuedAt := func(issuedAt time.Time) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+	fresh := claimsIssuedAt(now)
+
+	edPrivate := ring.keys["ed"].signKey
+
+	numericKidToken := jwt.NewWithClaims(jwt.SigningMethodHS256, fresh)
+	numericKidToken.Header["kid"] = 7
+	numericKid, err := numericKidToken.SignedString([]byte("current secret"))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "active key",
+			token: signTestToken(t, jwt.SigningMethodHS256, []byte("current secret"), "current", fresh),
+		},
+		{
+			name:  "eddsa key",
+			token: signTestToken(t, jwt.SigningMethodEdDSA, edPrivate, "ed", fresh),
+		},
+		{
+			name:  "legacy token without a kid",
+			token: signTestToken(t, jwt.SigningMethodHS256, []byte("legacy secret"), "", fresh),
+		},
+		{
+			name:    "legacy token signed with another secret",
+			token:   signTestToken(t, jwt.SigningMethodHS256, []byte("current secret"), "", fresh),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   signTestToken(t, jwt.SigningMethodHS256, []byte("current secret"), "nope", fresh),
+			wantErr: true,
+		},
+		{
+			name:    "kid that is not a string",
+			token:   numericKid,
+			wantErr: true,
+		},
+		{
+			name:    "algorithm other than the key's",
+			token:   signTestToken(t, jwt.SigningMethodHS384, []byte("current secret"), "current", fresh),
+			wantErr: true,
+		},
+		{
+			name:    "hmac token claiming an eddsa key",
+			token:   signTestToken(t, jwt.SigningMethodHS256, []byte(edPublic), "ed", fresh),
+			wantErr: true,
+		},
+		{
+			name:  "retired key, issued before retirement",
+			token: signTestToken(t, jwt.SigningMethodHS256, []byte("retired secret"), "retired", claimsIssuedAt(retiredAt.Add(-time.Minute))),
+		},
+		{
+			name:    "retired key, issued after retirement",
+			token:   signTestToken(t, jwt.SigningMethodHS256, []byte("retired secret"), "retired", fresh),
+			wantErr: true,
+		},
+		{
+			name:    "retired key, no iat",
+			token:   signTestToken(t, jwt.SigningMethodHS256, []byte("retired secret"), "retired", jwt.RegisteredClaims{ExpiresAt: fresh.ExpiresAt}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.ParseWithClaims(tt.token, &jwt.RegisteredClaims{}, keys.keyFunc)
+			if tt.wantErr && err == nil {
+				t.Fatal("token was accepted")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("token was refused: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyStoreRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	writeKeys := func(config keyringConfig, modTime time.Time) {
+		t.Helper()
+
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("marshalling keys: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("writing keys: %v", err)
+		}
+		// Reloads are keyed on the modification time, which may not tick
+		// between two quick writes.
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("setting modification time: %v", err)
+		}
+	}
+
+	verifies := func(keys *keyStore, token string) bool {
+		_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, keys.keyFunc)
+		return err == nil
+	}
+	kidOf := func(token string) interface{} {
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+		if err != nil {
+			t.Fatalf("parsing token: %v", err)
+		}
+		return parsed.Header["kid"]
+	}
+
+	now := time.Now()
+	writeKeys(keyringConfig{Active: "one", Keys: []signingKeyConfig{{ID: "one", Secret: "first"}}}, now.Add(-time.Minute))
+
+	keys, err := newKeyStore(path, "unused")
+	if err != nil {
+		t.Fatalf("newKeyStore: %v", err)
+	}
+
+	oldToken, err := keys.sign(jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now.Add(-time.Second))})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if kid := kidOf(oldToken); kid != "one" {
+		t.Fatalf("token signed with kid %v, want one", kid)
+	}
+
+	retiredAt := now
+	writeKeys(keyringConfig{Active: "two", Keys: []signingKeyConfig{
+		{ID: "two", Secret: "second"},
+		{ID: "one", Secret: "first", RetiredAt: &retiredAt},
+	}}, now)
+
+	changed, err := keys.reload()
+	if err != nil || !changed {
+		t.Fatalf("reload = %v, %v; want a change", changed, err)
+	}
+
+	newToken, err := keys.sign(jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now)})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if kid := kidOf(newToken); kid != "two" {
+		t.Errorf("token signed with kid %v after rotation, want two", kid)
+	}
+	if !verifies(keys, newToken) {
+		t.Error("token from the new key was refused")
+	}
+	if !verifies(keys, oldToken) {
+		t.Error("token issued before the old key was retired was refused")
+	}
+
+	// A bad keys file keeps the last good keyring in place.
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatalf("writing keys: %v", err)
+	}
+	if err := os.Chtimes(path, now.Add(time.Minute), now.Add(time.Minute)); err != nil {
+		t.Fatalf("setting modification time: %v", err)
+	}
+	if _, err := keys.reload(); err == nil {
+		t.Error("reload accepted a malformed keys file")
+	}
+	if !verifies(keys, newToken) {
+		t.Error("malformed keys file replaced the keyring")
+	}
+}
+
+func TestKeyStoreFallbackSecret(t *testing.T) {
+	keys, err := newKeyStore("", "secret")
+	if err != nil {
+		t.Fatalf("newKeyStore: %v", err)
+	}
+
+	token, err := keys.sign(jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	// Tokens from before key IDs existed were signed with the same secret
+	// and no kid, and must keep working.
+	legacy := signTestToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.RegisteredClaims{})
+	for _, tokenString := range []string{token, legacy} {
+		if _, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, keys.keyFunc); err != nil {
+			t.Errorf("token refused: %v", err)
+		}
+	}
+
+	if _, err := newKeyStore("", ""); err == nil {
+		t.Error("newKeyStore accepted an empty JWT_SECRET with no keys file")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -14,8 +15,12 @@ import (
 
 type apiConfig struct {
 	fileserverHits int
-	jwtSecret      string
+	keys           *keyStore
 	polkaKey       string
+	mediaDir       string
+	chirpFilters   filterChain
+	adminIDs       map[int]bool
+	revocations    revocationMetrics
 }
 
 type contextKey string
@@ -28,10 +33,32 @@ func main() {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	polkaKey := os.Getenv("POLKA_KEY")
 
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+
+	adminIDs, err := parseAdminIDs(os.Getenv("CHIRPY_ADMINS"))
+	if err != nil {
+		log.Fatalf("Error parsing CHIRPY_ADMINS: %v", err)
+	}
+
+	keysPath := os.Getenv("JWT_KEYS_FILE")
+
+	filtersPath := os.Getenv("CHIRPY_FILTERS")
+	if filtersPath == "" {
+		filtersPath = "filters.json"
+	}
+
 	const filepathRoot = "."
 	const port = "8080"
 
-	db, err := database.NewDB("database.json")
+	dbg := flag.Bool("debug", false, "Enable debug mode")
+	storeKind := flag.String("store", os.Getenv("CHIRPY_STORE"), "Storage backend to use (json or sqlite)")
+
+	flag.Parse()
+
+	db, err := openStore(*storeKind, *dbg)
 	if err != nil {
 		log.Fatalf("Error initializing the database: %v", err)
 	}
@@ -41,25 +68,30 @@ func main() {
 		}
 	}()
 
-	dbg := flag.Bool("debug", false, "Enable debug mode")
+	var apiCfg apiConfig
+	apiCfg.polkaKey = polkaKey
+	apiCfg.mediaDir = mediaDir
+	apiCfg.adminIDs = adminIDs
 
-	flag.Parse()
+	keys, err := newKeyStore(keysPath, jwtSecret)
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %v", err)
+	}
+	if keysPath != "" {
+		go watchReload("JWT signing keys from "+keysPath, keysReloadInterval, keys.reload)
+	}
 
-	if *dbg {
-		_, err := os.Stat("database.json")
-		if err == nil {
-			err := db.DeleteDB("database.json")
-			if err != nil {
-				log.Fatalf("Error deleting the database: %v", err)
-			}
-		} else if !os.IsNotExist(err) {
-			log.Fatalf("Error checking for database file: %v", err)
-		}
+	apiCfg.keys = keys
+
+	wordFilter, err := newWordFilter(filtersPath)
+	if err != nil {
+		log.Fatalf("Error loading the word filter: %v", err)
 	}
+	go watchReload("word filter from "+filtersPath, filterReloadInterval, wordFilter.reload)
 
-	var apiCfg apiConfig
-	apiCfg.jwtSecret = jwtSecret
-	apiCfg.polkaKey = polkaKey
+	apiCfg.chirpFilters = filterChain{wordFilter}
+
+	go apiCfg.sweepRevokedTokens(db)
 
 	r := chi.NewRouter()
 	r_endpoints := chi.NewRouter()
@@ -69,28 +101,68 @@ func main() {
 
 	r.Handle("/app/*", apiCfg.middlewareMetricsInc(fileServer))
 	r.Handle("/app", apiCfg.middlewareMetricsInc(fileServer))
+	r.Get("/.well-known/jwks.json", apiCfg.jwksHandler)
 
 	corsMux := middlewareCors(r)
 
+	requireAuth := r_endpoints.With(apiCfg.RequireAuth(db))
+	optionalAuth := r_endpoints.With(apiCfg.OptionalAuth)
+
 	r_endpoints.Get("/healthz", readinessHandler)
 	r_endpoints.Get("/reset", apiCfg.resetCounterHandler)
 
-	r_endpoints.Post("/chirps", withDB(apiCfg.createChirpHandler, db))
-	r_endpoints.Get("/chirps", withDB(listChirpsHandler, db))
-	r_endpoints.Get("/chirps/{chirpID}", withDB(getChirpByID, db))
-	r_endpoints.Delete("/chirps/{chirpID}", withDB(apiCfg.deleteChirpHandler, db))
+	requireAuth.Post("/chirps", withDB(apiCfg.createChirpHandler, db))
+	optionalAuth.Get("/chirps", withDB(apiCfg.listChirpsHandler, db))
+	optionalAuth.Get("/chirps/{chirpID}", withDB(apiCfg.getChirpByID, db))
+	requireAuth.Put("/chirps/{chirpID}", withDB(apiCfg.updateChirpHandler, db))
+	requireAuth.Delete("/chirps/{chirpID}", withDB(apiCfg.deleteChirpHandler, db))
+	optionalAuth.Get("/chirps/{chirpID}/revisions", withDB(apiCfg.listChirpRevisionsHandler, db))
+	optionalAuth.Get("/chirps/{chirpID}/replies", withDB(apiCfg.listRepliesHandler, db))
+	optionalAuth.Get("/chirps/{chirpID}/thread", withDB(apiCfg.getThreadHandler, db))
+	requireAuth.Post("/chirps/{chirpID}/like", withDB(apiCfg.likeChirpHandler, db))
+	requireAuth.Delete("/chirps/{chirpID}/like", withDB(apiCfg.unlikeChirpHandler, db))
+	requireAuth.Post("/chirps/{chirpID}/rechirp", withDB(apiCfg.rechirpHandler, db))
+	requireAuth.Post("/chirps/{chirpID}/report", withDB(apiCfg.reportChirpHandler, db))
 
 	r_endpoints.Post("/users", withDB(createUserHandler, db))
-	r_endpoints.Put("/users", withDB(apiCfg.updateUserHandler, db))
+	requireAuth.Put("/users", withDB(apiCfg.updateUserHandler, db))
+	optionalAuth.Get("/users/{username}", withDB(apiCfg.getUserProfileHandler, db))
+	requireAuth.Post("/users/{userID}/follow", withDB(apiCfg.followUserHandler, db))
+	requireAuth.Delete("/users/{userID}/follow", withDB(apiCfg.unfollowUserHandler, db))
+	r_endpoints.Get("/users/{userID}/followers", withDB(listFollowersHandler, db))
+	r_endpoints.Get("/users/{userID}/following", withDB(listFollowingHandler, db))
 	r_endpoints.Post("/login", withDB(apiCfg.loginUserHandler, db))
 
+	requireAuth.Get("/timeline", withDB(apiCfg.timelineHandler, db))
+
+	optionalAuth.Get("/hashtags/{tag}/chirps", withDB(apiCfg.listHashtagChirpsHandler, db))
+	r_endpoints.Get("/trending", withDB(trendingHashtagsHandler, db))
+
+	optionalAuth.Get("/search", withDB(apiCfg.searchHandler, db))
+
+	requireAuth.Post("/media", withDB(apiCfg.uploadMediaHandler, db))
+	r_endpoints.Get("/media/{mediaID}", withDB(apiCfg.getMediaHandler, db))
+
+	requireAuth.Get("/notifications", withDB(apiCfg.listNotificationsHandler, db))
+	requireAuth.Post("/notifications/read", withDB(apiCfg.markNotificationsReadHandler, db))
+
 	r_endpoints.Post("/refresh", withDB(apiCfg.refreshTokenHandler, db))
 	r_endpoints.Post("/revoke", withDB(apiCfg.revokeTokenHandler, db))
 
 	r_endpoints.Post("/polka/webhooks", withDB(apiCfg.polkaWebhookHandler, db))
 
+	adminAuth := r_admin.With(apiCfg.RequireAuth(db))
+
 	r_admin.Get("/metrics", apiCfg.requestCounterHandler)
 
+	adminAuth.Get("/reports", withDB(apiCfg.requireAdmin(listReportQueueHandler), db))
+	adminAuth.Post("/chirps/{chirpID}/hide", withDB(apiCfg.requireAdmin(apiCfg.hideChirpHandler), db))
+	adminAuth.Post("/chirps/{chirpID}/restore", withDB(apiCfg.requireAdmin(apiCfg.restoreChirpHandler), db))
+	adminAuth.Delete("/chirps/{chirpID}", withDB(apiCfg.requireAdmin(apiCfg.adminDeleteChirpHandler), db))
+	adminAuth.Post("/users/{userID}/suspend", withDB(apiCfg.requireAdmin(apiCfg.suspendUserHandler), db))
+	adminAuth.Delete("/users/{userID}/suspend", withDB(apiCfg.requireAdmin(apiCfg.unsuspendUserHandler), db))
+	adminAuth.Get("/moderation-log", withDB(apiCfg.requireAdmin(listModerationLogHandler), db))
+
 	r.Mount("/api", r_endpoints)
 	r.Mount("/admin", r_admin)
 
@@ -107,9 +179,37 @@ func main() {
 	}
 }
 
-func withDB(next http.HandlerFunc, db *database.DB) http.HandlerFunc {
+func withDB(next http.HandlerFunc, db database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.WithValue(r.Context(), dbContextKey, db)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+func openStore(kind string, debug bool) (database.Store, error) {
+	switch kind {
+	case "", "json":
+		db, err := database.NewDB("database.json")
+		if err != nil {
+			return nil, err
+		}
+
+		if debug {
+			if err := db.DeleteDB("database.json"); err != nil {
+				return nil, err
+			}
+		}
+
+		return db, nil
+	case "sqlite":
+		if debug {
+			if err := os.Remove("database.db"); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		return database.NewSQLiteDB("database.db")
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", kind)
+	}
+}
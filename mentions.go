@@ -0,0 +1,93 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+// mentionPattern matches @ followed by an email address or by username
+// characters. The last group catches a mention that runs on into other
+// letters, a hyphen, another @ or a dotted word, so that @al-ice or
+// @bob.smith is skipped rather than cut short to @al or @bob.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}._%+-]+@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+|[A-Za-z0-9_]+)([\p{L}\p{N}_@-]|\.[\p{L}\p{N}_])?`)
+
+func extractMentions(body string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		if match[2] != "" {
+			continue
+		}
+
+		mention := strings.ToLower(match[1])
+		if seen[mention] {
+			continue
+		}
+		seen[mention] = true
+		mentions = append(mentions, mention)
+	}
+
+	return mentions
+}
+
+// resolveMentions returns the users mentioned by username, which are
+// recorded on the chirp, and those mentioned by email, which are only
+// notified. Echoing email matches back in the chirp would let anyone probe
+// which addresses are registered.
+func resolveMentions(db database.Store, body string) ([]int, []int, error) {
+	mentions := extractMentions(body)
+	if len(mentions) == 0 {
+		return nil, nil, nil
+	}
+
+	users, err := db.GetUsers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byHandle := make(map[string]int, len(users))
+	byEmail := make(map[string]int, len(users))
+	for _, user := range users {
+		if user.Username != "" {
+			byHandle[user.Username] = user.ID
+		}
+		byEmail[strings.ToLower(user.Email)] = user.ID
+	}
+
+	var userIDs, emailUserIDs []int
+	for _, mention := range mentions {
+		if strings.Contains(mention, "@") {
+			if userID, ok := byEmail[mention]; ok {
+				emailUserIDs = append(emailUserIDs, userID)
+			}
+		} else if userID, ok := byHandle[mention]; ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	return userIDs, emailUserIDs, nil
+}
+
+func notifyMentions(db database.Store, chirp database.Chirp, mentioned []int, alreadyNotified []int) {
+	skip := make(map[int]bool, len(alreadyNotified))
+	for _, userID := range alreadyNotified {
+		skip[userID] = true
+	}
+
+	for _, userID := range mentioned {
+		if skip[userID] {
+			continue
+		}
+		skip[userID] = true
+
+		notify(db, database.Notification{
+			UserID:  userID,
+			Type:    database.NotificationMention,
+			ActorID: chirp.AuthorID,
+			ChirpID: &chirp.ID,
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -20,8 +21,15 @@ func (cfg *apiConfig) requestCounterHandler(w http.ResponseWriter, r *http.Reque
 			<body>
 				<h1>Welcome, Chirpy Admin</h1>
 				<p>Chirpy has been visited %d times!</p>
+				<p>Revoked tokens: %d (%d expired entries purged, last sweep %s)</p>
 			</body>
 		</html>`
 
-	fmt.Fprintf(w, htmlContent, cfg.fileserverHits)
+	lastSweep := "never"
+	if unix := cfg.revocations.lastSweep.Load(); unix != 0 {
+		lastSweep = time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	}
+
+	fmt.Fprintf(w, htmlContent, cfg.fileserverHits,
+		cfg.revocations.size.Load(), cfg.revocations.purged.Load(), lastSweep)
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+func parseAdminIDs(s string) (map[int]bool, error) {
+	adminIDs := make(map[int]bool)
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		userID, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin user ID %q", field)
+		}
+		adminIDs[userID] = true
+	}
+
+	return adminIDs, nil
+}
+
+func (cfg *apiConfig) isAdmin(userID int) bool {
+	return cfg.adminIDs[userID]
+}
+
+func (cfg *apiConfig) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := principalFrom(r.Context())
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "JWT token is missing or invalid")
+			return
+		}
+
+		// The token must have been minted for an admin, and the user must
+		// still be one.
+		if !principal.HasScope(scopeAdmin) || !cfg.isAdmin(principal.UserID) {
+			respondWithError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Hidden chirps stay visible to their author and to admins.
+func (cfg *apiConfig) chirpVisibleTo(viewerID int, authenticated bool, chirp database.Chirp) bool {
+	if chirp.HiddenAt == nil {
+		return true
+	}
+
+	return authenticated && (viewerID == chirp.AuthorID || cfg.isAdmin(viewerID))
+}
+
+// maskHiddenRefs swaps inline rechirp and quote refs the viewer may not see
+// for a tombstone, as is done for deleted originals.
+func (cfg *apiConfig) maskHiddenRefs(viewerID int, authenticated bool, chirp database.Chirp) database.Chirp {
+	mask := func(ref *database.ChirpRef) *database.ChirpRef {
+		if ref == nil || ref.Chirp == nil || cfg.chirpVisibleTo(viewerID, authenticated, *ref.Chirp) {
+			return ref
+		}
+		return &database.ChirpRef{ID: ref.ID, Hidden: true}
+	}
+
+	chirp.RechirpOf = mask(chirp.RechirpOf)
+	chirp.QuotedChirp = mask(chirp.QuotedChirp)
+
+	return chirp
+}
+
+func (cfg *apiConfig) canViewChirp(r *http.Request, chirp database.Chirp) bool {
+	principal, ok := principalFrom(r.Context())
+	return cfg.chirpVisibleTo(principal.UserID, ok, chirp)
+}
+
+// lookupVisibleChirp fetches a chirp for the request, answering 404 itself
+// when the chirp doesn't exist or is hidden from the viewer.
+func (cfg *apiConfig) lookupVisibleChirp(w http.ResponseWriter, r *http.Request, db database.Store, chirpID int) (database.Chirp, bool) {
+	chirp, err := db.GetChirp(chirpID)
+	if errors.Is(err, database.ErrNotFound) || err == nil && !cfg.canViewChirp(r, chirp) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirp")
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+// viewableChirp prepares a single chirp the viewer is allowed to see for a
+// response.
+func (cfg *apiConfig) viewableChirp(r *http.Request, chirp database.Chirp) database.Chirp {
+	principal, ok := principalFrom(r.Context())
+	return cfg.maskHiddenRefs(principal.UserID, ok, chirp)
+}
+
+func (cfg *apiConfig) visibleChirps(r *http.Request, chirps []database.Chirp) []database.Chirp {
+	principal, ok := principalFrom(r.Context())
+
+	visible := make([]database.Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		if cfg.chirpVisibleTo(principal.UserID, ok, chirp) {
+			visible = append(visible, cfg.maskHiddenRefs(principal.UserID, ok, chirp))
+		}
+	}
+
+	return visible
+}
+
+func isSuspended(db database.Store, userID int) bool {
+	user, err := db.GetUser(userID)
+	return err == nil && user.SuspendedAt != nil
+}
+
+func recordModeration(db database.Store, action database.ModerationAction) {
+	target := ""
+	if action.ChirpID != nil {
+		target += fmt.Sprintf(" chirp=%d", *action.ChirpID)
+	}
+	if action.UserID != nil {
+		target += fmt.Sprintf(" user=%d", *action.UserID)
+	}
+	log.Printf("Moderation: admin=%d action=%s%s reason=%q", action.AdminID, action.Action, target, action.Reason)
+
+	if _, err := db.CreateModerationAction(action); err != nil {
+		log.Printf("Error recording moderation action: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type chirpSort struct {
+	field string
+	desc  bool
+}
+
+type pageCursor struct {
+	Sort          string    `json:"s"`
+	LastID        int       `json:"id"`
+	LastCreatedAt time.Time `json:"t"`
+	Offset        int       `json:"o,omitempty"`
+}
+
+type pageParams struct {
+	paged  bool
+	limit  int
+	cursor *pageCursor
+}
+
+type chirpPage struct {
+	Chirps     []database.Chirp `json:"chirps"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func parseChirpSort(s string) (chirpSort, error) {
+	field, dir, hasDir := strings.Cut(s, ":")
+
+	switch field {
+	case "", "asc":
+		return chirpSort{field: "id"}, nil
+	case "desc":
+		return chirpSort{field: "id", desc: true}, nil
+	case "id", "created_at":
+	default:
+		return chirpSort{}, errors.New("Invalid sort")
+	}
+
+	order := chirpSort{field: field}
+	if hasDir {
+		switch dir {
+		case "asc":
+		case "desc":
+			order.desc = true
+		default:
+			return chirpSort{}, errors.New("Invalid sort")
+		}
+	}
+
+	return order, nil
+}
+
+func (o chirpSort) String() string {
+	if o.desc {
+		return o.field + ":desc"
+	}
+	return o.field + ":asc"
+}
+
+func (o chirpSort) less(a, b database.Chirp) bool {
+	if o.field == "created_at" && !a.CreatedAt.Equal(b.CreatedAt) {
+		if o.desc {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+
+	if o.desc {
+		return a.ID > b.ID
+	}
+	return a.ID < b.ID
+}
+
+func sortChirps(chirps []database.Chirp, order chirpSort) {
+	sort.SliceStable(chirps, func(i, j int) bool {
+		return order.less(chirps[i], chirps[j])
+	})
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+func parsePageParams(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	params := pageParams{limit: defaultPageLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return pageParams{}, errors.New("Invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		params.limit = n
+		params.paged = true
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return pageParams{}, errors.New("Invalid cursor")
+		}
+		params.cursor = c
+		params.paged = true
+	}
+
+	return params, nil
+}
+
+func paginateChirps(chirps []database.Chirp, params pageParams, order chirpSort) ([]database.Chirp, string, error) {
+	start := 0
+	if params.cursor != nil {
+		if params.cursor.Sort != order.String() {
+			return nil, "", errors.New("Cursor does not match sort order")
+		}
+
+		last := database.Chirp{
+			ID:        params.cursor.LastID,
+			CreatedAt: params.cursor.LastCreatedAt,
+		}
+		for start < len(chirps) && !order.less(last, chirps[start]) {
+			start++
+		}
+	}
+
+	end := start + params.limit
+	if end >= len(chirps) {
+		return chirps[start:], "", nil
+	}
+
+	page := chirps[start:end]
+	last := page[len(page)-1]
+	next := encodeCursor(pageCursor{
+		Sort:          order.String(),
+		LastID:        last.ID,
+		LastCreatedAt: last.CreatedAt,
+	})
+
+	return page, next, nil
+}
+
+func paginateByIDDesc[T any](items []T, params pageParams, key string, idOf func(T) int) ([]T, string, error) {
+	start := 0
+	if params.cursor != nil {
+		if params.cursor.Sort != key {
+			return nil, "", errors.New("Cursor does not match listing")
+		}
+
+		for start < len(items) && idOf(items[start]) >= params.cursor.LastID {
+			start++
+		}
+	}
+
+	end := start + params.limit
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+
+	page := items[start:end]
+	next := encodeCursor(pageCursor{
+		Sort:   key,
+		LastID: idOf(page[len(page)-1]),
+	})
+
+	return page, next, nil
+}
+
+func paginateByOffset[T any](items []T, params pageParams, key string) ([]T, string, error) {
+	start := 0
+	if params.cursor != nil {
+		if params.cursor.Sort != key {
+			return nil, "", errors.New("Cursor does not match listing")
+		}
+		start = params.cursor.Offset
+		if start < 0 || start > len(items) {
+			start = len(items)
+		}
+	}
+
+	end := start + params.limit
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+
+	next := encodeCursor(pageCursor{
+		Sort:   key,
+		Offset: end,
+	})
+
+	return items[start:end], next, nil
+}
+
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", nextCursor)
+	next.RawQuery = query.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
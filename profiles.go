@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarLength      = 2048
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,19}$`)
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errors.New("Username must be 3-20 characters of letters, digits or underscores and start with a letter")
+	}
+
+	return nil
+}
+
+func validateProfile(profile database.Profile) error {
+	if profile.Username != "" {
+		if err := validateUsername(profile.Username); err != nil {
+			return err
+		}
+	}
+
+	if utf8.RuneCountInString(profile.DisplayName) > maxDisplayNameLength {
+		return errors.New("Display name is too long")
+	}
+
+	if utf8.RuneCountInString(profile.Bio) > maxBioLength {
+		return errors.New("Bio is too long")
+	}
+
+	if profile.Avatar != "" && !strings.HasPrefix(profile.Avatar, mediaURLPrefix) {
+		u, err := url.Parse(profile.Avatar)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(profile.Avatar) > maxAvatarLength {
+			return errors.New("Avatar must be an http or https URL")
+		}
+	}
+
+	return nil
+}
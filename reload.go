@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// watchReload calls reload every interval for the life of the process. A
+// failed reload is logged and the previously loaded version stays in use.
+func watchReload(name string, interval time.Duration, reload func() (bool, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloaded, err := reload()
+		if err != nil {
+			log.Printf("Error reloading %s, keeping previous version: %v", name, err)
+			continue
+		}
+		if reloaded {
+			log.Printf("Reloaded %s", name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+const revokedTokenSweepInterval = 10 * time.Minute
+
+type revocationMetrics struct {
+	size      atomic.Int64
+	purged    atomic.Int64
+	lastSweep atomic.Int64
+}
+
+// revokeToken adds a token to the revoked list until it would have expired
+// anyway. It returns database.ErrDuplicate if the token was already
+// revoked.
+func (cfg *apiConfig) revokeToken(db database.Store, tokenString string, claims *tokenClaims) error {
+	if err := db.StoreRevokedToken(tokenString, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if size, err := db.CountRevokedTokens(); err == nil {
+		cfg.revocations.size.Store(int64(size))
+	}
+
+	return nil
+}
+
+// sweepRevokedTokens purges revoked-list entries and refresh-token records
+// whose tokens have expired, once at startup and then every
+// revokedTokenSweepInterval.
+func (cfg *apiConfig) sweepRevokedTokens(db database.Store) {
+	ticker := time.NewTicker(revokedTokenSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg.sweepRevokedTokensOnce(db)
+		<-ticker.C
+	}
+}
+
+func (cfg *apiConfig) sweepRevokedTokensOnce(db database.Store) {
+	now := time.Now()
+
+	purged, err := db.PurgeExpiredRevokedTokens(now)
+	if err != nil {
+		log.Printf("Error purging expired revoked tokens: %v", err)
+	}
+	cfg.revocations.purged.Add(int64(purged))
+	cfg.revocations.lastSweep.Store(now.Unix())
+
+	refreshPurged, err := db.PurgeExpiredRefreshTokens(now)
+	if err != nil {
+		log.Printf("Error purging expired refresh tokens: %v", err)
+	} else if refreshPurged > 0 {
+		log.Printf("Purged %d expired refresh tokens", refreshPurged)
+	}
+
+	size, err := db.CountRevokedTokens()
+	if err != nil {
+		log.Printf("Error counting revoked tokens: %v", err)
+		return
+	}
+	cfg.revocations.size.Store(int64(size))
+
+	if purged > 0 {
+		log.Printf("Purged %d expired revoked tokens, %d remain", purged, size)
+	}
+}
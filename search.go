@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tmbrody/chirpyGo/database"
+)
+
+func parseSearchQuery(q string) (database.SearchQuery, error) {
+	var query database.SearchQuery
+
+	for _, field := range splitSearchQuery(q) {
+		switch {
+		case strings.HasPrefix(field, `"`):
+			phrase := database.Tokenize(strings.Trim(field, `"`))
+			switch len(phrase) {
+			case 0:
+			case 1:
+				query.Terms = append(query.Terms, phrase[0])
+			default:
+				query.Phrases = append(query.Phrases, phrase)
+			}
+		case strings.HasPrefix(strings.ToLower(field), "from:"):
+			authorID, err := strconv.Atoi(field[len("from:"):])
+			if err != nil {
+				return database.SearchQuery{}, errors.New("Invalid from: operator")
+			}
+			if query.AuthorID != nil && *query.AuthorID != authorID {
+				return database.SearchQuery{}, errors.New("Only one from: operator is allowed")
+			}
+			query.AuthorID = &authorID
+		case strings.HasPrefix(field, "#"):
+			tag := normalizeHashtag(strings.TrimPrefix(field, "#"))
+			if tag == "" {
+				return database.SearchQuery{}, errors.New("Invalid hashtag")
+			}
+			query.Hashtags = append(query.Hashtags, tag)
+		default:
+			query.Terms = append(query.Terms, database.Tokenize(field)...)
+		}
+	}
+
+	if len(query.Terms) == 0 && len(query.Phrases) == 0 && query.AuthorID == nil && len(query.Hashtags) == 0 {
+		return database.SearchQuery{}, errors.New("Search query is empty")
+	}
+
+	return query, nil
+}
+
+// splitSearchQuery splits on whitespace, keeping double-quoted phrases
+// (quotes included) together as a single field. An unterminated quote runs
+// to the end of the query.
+func splitSearchQuery(q string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuote := false
+
+	flush := func() {
+		if current.Len() > 0 {
+			fields = append(fields, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			if !inQuote {
+				flush()
+			}
+			current.WriteRune(r)
+			if inQuote {
+				flush()
+			}
+			inQuote = !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return fields
+}